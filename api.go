@@ -0,0 +1,136 @@
+package stroo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Options are the equivalent of the command line flags, for using stroo as a library
+type Options struct {
+	Dir          string   // packages, template and output are relative to it (current folder if empty)
+	Patterns     []string // packages to process e.g. "./..." (defaults to ".")
+	Types        []string // names or glob patterns e.g. "*Request"
+	Marker       string   // process every type having this text in it's comment
+	Directives   bool     // run the generations requested by `//stroo:gen` comments (template and output are not needed)
+	Template     string   // comma separated files, directories or globs
+	TemplatesDir string   // shared partials
+	Entry        string   // the template to execute, when there are more (defaults to the first file)
+	Output       string   // file name or pattern e.g. "{{.Kind | snakecase}}_gen.go", relative to each package folder
+	Target       string
+	DryRun       bool // nothing is written, the generated code is in Result.Out
+	Check        bool // nothing is written, the diff with the files on disk is in Result.Out
+	Force        bool // overwrite files which were not generated by stroo
+	Timestamp    bool // write the time of generation in the header
+	DebugPrint   bool
+}
+
+// Result of Generate
+type Result struct {
+	Packages []PackageReport
+	Outputs  []string // all the files generated
+	Stale    []string // in check mode, the files which are not up to date
+	Out      []byte   // generated code in dry run, diff in check mode
+}
+
+// Generate loads the packages, then analyses and generates each of them. It never exits the process and doesn't
+// read the command line : the error is returned, along with the result, which tells what happened to every package
+func Generate(ctx context.Context, options Options) (*Result, error) {
+	if options.Template == "" && !options.Directives {
+		return nil, errors.New("template is required (or directives)")
+	}
+	if len(options.Types) == 0 && options.Marker == "" && !options.Directives {
+		return nil, errors.New("types or marker are required (or directives)")
+	}
+	if options.Output == "" && !options.Directives && !options.DryRun && !options.Check {
+		return nil, errors.New("output is required (or directives)")
+	}
+	dir := options.Dir
+	if dir == "" {
+		dir = "."
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	inDir := func(name string) string {
+		if name == "" || filepath.IsAbs(name) || strings.HasPrefix(name, BuiltinPrefix) {
+			return name
+		}
+		return filepath.Join(dir, name)
+	}
+	var templateFiles []string
+	for _, templateFile := range strings.Split(options.Template, ",") {
+		templateFiles = append(templateFiles, inDir(strings.TrimSpace(templateFile)))
+	}
+
+	// the flags are still the configuration (and they are written in the header of generated files)
+	analyzer := DefaultAnalyzer()
+	for name, value := range map[string]string{
+		"type":          strings.Join(options.Types, ","),
+		"marker":        options.Marker,
+		"directives":    strconv.FormatBool(options.Directives),
+		"template":      options.Template,
+		"templates-dir": options.TemplatesDir,
+		"entry":         options.Entry,
+		"output":        options.Output,
+		"target":        options.Target,
+		"testMode":      strconv.FormatBool(options.DryRun),
+		"check":         strconv.FormatBool(options.Check),
+		"force":         strconv.FormatBool(options.Force),
+		"timestamp":     strconv.FormatBool(options.Timestamp),
+		"debugPrint":    strconv.FormatBool(options.DebugPrint),
+	} {
+		if err := analyzer.Flags.Set(name, value); err != nil {
+			return nil, fmt.Errorf("option %q : %v", name, err)
+		}
+	}
+	command, err := newCommand(analyzer)
+	if err != nil {
+		return nil, err
+	}
+	command.WorkingDir = dir
+	command.TemplateFile = strings.Join(templateFiles, ",")
+	command.TemplatesDir = inDir(options.TemplatesDir)
+
+	patterns := options.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	loaded, err := loadPackages(ctx, dir, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &Result{Packages: command.GenerateAll(analyzer, loaded)}
+	result.Outputs = command.Outputs
+	result.Stale = command.Stale
+	result.Out = command.Out.Bytes()
+
+	var errs []error
+	generated := false
+	for _, report := range result.Packages {
+		if report.Err != nil {
+			errs = append(errs, fmt.Errorf("%s : %w", report.Path, report.Err))
+		}
+		if !report.Skipped {
+			generated = true
+		}
+	}
+	if err := command.Unmatched(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return result, errors.Join(errs...)
+	}
+	if !generated {
+		return result, ErrNothingSelected
+	}
+	return result, nil
+}
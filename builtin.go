@@ -0,0 +1,50 @@
+package stroo
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// BuiltinPrefix addresses the templates embedded in the binary e.g. `-template=builtin:json-marshal`
+const BuiltinPrefix = "builtin:"
+
+//go:embed templates/builtin/*.tmpl
+var builtinTemplates embed.FS
+
+const builtinDir = "templates/builtin"
+
+// BuiltinTemplate describes one of the embedded templates
+type BuiltinTemplate struct {
+	Name        string // e.g. json-marshal
+	Description string // the comment on the first line of the template
+}
+
+// lists the embedded templates, sorted by name
+func BuiltinTemplates() ([]BuiltinTemplate, error) {
+	entries, err := fs.ReadDir(builtinTemplates, builtinDir)
+	if err != nil {
+		return nil, err
+	}
+	var result []BuiltinTemplate
+	for _, entry := range entries {
+		content, err := fs.ReadFile(builtinTemplates, path.Join(builtinDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		// first line is `{{/* description */}}`
+		firstLine := strings.SplitN(string(content), "\n", 2)[0]
+		description := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(firstLine, "{{/*"), "*/}}"))
+		result = append(result, BuiltinTemplate{
+			Name:        strings.ReplaceAll(strings.TrimSuffix(entry.Name(), ".tmpl"), "_", "-"),
+			Description: description,
+		})
+	}
+	return result, nil
+}
+
+// the file name inside the embedded folder, e.g. `json_marshal.tmpl` for `builtin:json-marshal`
+func builtinFile(name string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(name, BuiltinPrefix), "-", "_") + ".tmpl"
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	. "github.com/badu/stroo"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
 )
 
 func main() {
@@ -11,6 +15,21 @@ func main() {
 	// set the logger
 	log.SetFlags(0)
 	log.SetPrefix(ToolName + ": ")
+	// `stroo templates list` shows the builtin templates
+	if len(os.Args) > 1 && os.Args[1] == "templates" {
+		if len(os.Args) != 3 || os.Args[2] != "list" {
+			log.Fatalf("usage : %s templates list", ToolName)
+		}
+		builtins, err := BuiltinTemplates()
+		if err != nil {
+			log.Fatalf("error listing templates : %v", err)
+		}
+		for _, builtin := range builtins {
+			fmt.Printf("%s%-18s %s\n", BuiltinPrefix, builtin.Name, builtin.Description)
+		}
+		return
+	}
+
 	// check flags
 	if err := codeBuilder.Flags.Parse(os.Args[1:]); err != nil {
 		log.Fatalf("error parsing flags: %v", err)
@@ -24,28 +43,102 @@ func main() {
 	}
 
 	// check if vital things are missing from the configuration
-	if command.TemplateFile == "" || command.SelectedType == "" || (!command.TestMode && command.OutputFile == "") {
+	// (with `directives`, template, types and output come from the `//stroo:gen` comments)
+	if !command.Directives && (command.TemplateFile == "" || (command.SelectedType == "" && command.Marker == "") || (!command.TestMode && command.OutputFile == "")) {
 		codeBuilder.Flags.Usage()
 		os.Exit(1)
 	}
 
 	// print the current configuration
 	log.Printf("received params : %s\n", Print(codeBuilder, true))
-	loaded, err := LoadPackage(".")
+	// packages to process e.g. `stroo -directives ./...` (defaults to the current one)
+	patterns := codeBuilder.Flags.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	// `-watch` keeps running until interrupted, printing what happens on every generation
+	if command.Watch {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err := command.WatchAll(ctx, codeBuilder, patterns, func(reports []PackageReport, err error) {
+			if err != nil {
+				log.Printf("error : %v", err)
+				return
+			}
+			printOut(command)
+			summary(command, reports)
+			if err := command.Unmatched(); err != nil {
+				log.Printf("error : %v", err)
+			}
+			log.Printf("watching for changes (ctrl+c to stop)")
+		})
+		if err != nil {
+			log.Fatalf("error loading : %v", err)
+		}
+		return
+	}
+
+	loaded, err := LoadPackages(patterns...)
 	if err != nil {
 		log.Fatalf("error loading : %v", err)
 	}
-	log.Printf("loaded %q from %q", loaded.Name, loaded.PkgPath)
-	if err := command.Analyse(codeBuilder, loaded); err != nil {
-		log.Fatalf("error analysing : %v", err)
+	for _, loadedPackage := range loaded {
+		log.Printf("loaded %q from %q", loadedPackage.Name, loadedPackage.PkgPath)
 	}
 
-	if err := command.Generate(codeBuilder); err != nil {
-		log.Fatalf("error generating : %v", err)
+	reports := command.GenerateAll(codeBuilder, loaded)
+	printOut(command)
+	failed, generated := summary(command, reports)
+	if failed > 0 {
+		log.Fatalf("%d of %d package(s) failed", failed, len(reports))
 	}
+	if err := command.Unmatched(); err != nil {
+		log.Fatalf("error : %v", err)
+	}
+	if generated == 0 {
+		if command.SelectedType != "" && !command.Directives {
+			log.Fatalf("nothing was generated for -type=%s", command.SelectedType)
+		}
+		// e.g. `stroo -directives ./...` in a module which has no directives yet
+		log.Printf("nothing was generated")
+	}
+	if len(command.Stale) > 0 {
+		log.Fatalf("%d generated file(s) are not up to date : run go generate", len(command.Stale))
+	}
+}
 
+// prints the generated code in test mode, or the diff in check mode
+func printOut(command *Command) {
 	if command.TestMode {
 		log.Printf("%s\n", command.Out.String())
 		log.Println("file not written because test mode is set")
+	} else if command.Check {
+		// the diff goes to stdout, so it can be piped
+		_, _ = os.Stdout.Write(command.Out.Bytes())
+	}
+}
+
+// prints what happened to every package, returning the number of failed packages and of generated files
+func summary(command *Command, reports []PackageReport) (int, int) {
+	failed, generated := 0, 0
+	for _, report := range reports {
+		switch {
+		case report.Err != nil:
+			failed++
+			log.Printf("%s : error : %v", report.Path, report.Err)
+		case report.Skipped:
+			log.Printf("%s : nothing to generate", report.Path)
+		case command.Check:
+			generated += len(report.Outputs)
+			if len(report.Stale) > 0 {
+				log.Printf("%s : stale %s", report.Path, strings.Join(report.Stale, ", "))
+			} else {
+				log.Printf("%s : up to date", report.Path)
+			}
+		default:
+			generated += len(report.Outputs)
+			log.Printf("%s : %s", report.Path, strings.Join(report.Outputs, ", "))
+		}
 	}
+	return failed, generated
 }
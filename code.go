@@ -3,7 +3,9 @@ package stroo
 import (
 	"errors"
 	"fmt"
+	"go/types"
 	"log"
+	"sort"
 	"strings"
 	"text/template"
 	"time"
@@ -17,8 +19,6 @@ type Code struct {
 	tmpl        *template.Template     // reference to template, so we don't pass it as parameter
 }
 
-var Root *Code
-
 func New(
 	info *PackageInfo,
 	config CodeConfig,
@@ -28,6 +28,9 @@ func New(
 		PackageInfo: info,
 		CodeConfig:  config,
 	}
+	if len(result.CodeConfig.SelectedTypes) == 0 && result.CodeConfig.SelectedType != "" {
+		result.CodeConfig.SelectedTypes = []string{result.CodeConfig.SelectedType}
+	}
 	// reset keeper
 	result.ResetKeeper()
 	// add imports (they get cleared by importer tool)
@@ -35,21 +38,29 @@ func New(
 		result.AddToImports(imprt.Path)
 	}
 	if tmpl != nil {
-		result.tmpl = tmpl
+		// a clone, so the same parsed template can be bound to many codes
+		clone, err := tmpl.Clone()
+		if err != nil {
+			return nil, err
+		}
+		result.tmpl = clone.Funcs(result.FuncMap())
 	}
-	Root = result // set global, there is no other way to make template aware of the "common"
 	return result, nil
 }
 
 // getters for config - to be accessible from template
 func (c *Code) SelectedType() string           { return c.CodeConfig.SelectedType }
+func (c *Code) SelectedTypes() []string        { return c.CodeConfig.SelectedTypes }
 func (c *Code) TestMode() bool                 { return c.CodeConfig.TestMode }
 func (c *Code) DebugPrint() bool               { return c.CodeConfig.DebugPrint }
 func (c *Code) Serve() bool                    { return c.CodeConfig.Serve }
 func (c *Code) TemplateFile() string           { return c.CodeConfig.TemplateFile }
 func (c *Code) OutputFile() string             { return c.CodeConfig.OutputFile }
 func (c *Code) SelectedPeerType() string       { return c.CodeConfig.SelectedPeerType }
-func (c *Code) Tmpl() *template.Template       { return c.tmpl } // can't really say what's the usage, but we're open
+func (c *Code) Peer() *TypeInfo                { return c.CodeConfig.peer }
+func (c *Code) Options() map[string]string     { return c.CodeConfig.Options }
+func (c *Code) Option(key string) string       { return c.CodeConfig.Options[key] } // e.g. {{ .Option "receiver" }}
+func (c *Code) Tmpl() *template.Template       { return c.tmpl }                    // can't really say what's the usage, but we're open
 func (c *Code) Keeper() map[string]interface{} { return c.keeper }
 func (c *Code) ResetKeeper()                   { c.keeper = make(map[string]interface{}) }
 func (c *Code) PackageName() string            { return c.PackageInfo.Name }
@@ -57,6 +68,10 @@ func (c *Code) PackageName() string            { return c.PackageInfo.Name }
 // gets a struct declaration by it's name
 func (c *Code) StructByKey(key string) (*TypeInfo, error) {
 	result := c.PackageInfo.Types.Extract(key)
+	if result == nil && strings.Contains(key, ".") {
+		// qualified, e.g. `time.Time` or `github.com/x/model.User`
+		return c.TypeOf(key)
+	}
 	if result == nil {
 		if c.DebugPrint() {
 			log.Printf("error looking for %q into types", key)
@@ -70,6 +85,23 @@ func (c *Code) StructByKey(key string) (*TypeInfo, error) {
 	return result, nil
 }
 
+// describes a type of any package, e.g. `typeOf "github.com/x/model.User"` or `typeOf "model.User"`
+func (c *Code) TypeOf(qualified string) (*TypeInfo, error) {
+	return c.PackageInfo.TypeOf(qualified)
+}
+
+// pairs the fields of a type with the ones of it's peer, e.g. `matchFields . $.Peer "json" "FullName=Name"` (see MatchFields)
+func (c *Code) MatchFields(typ, peer *TypeInfo, tagKey, mapping string) (FieldMatches, error) {
+	if typ == nil || peer == nil {
+		return nil, errors.New("matchFields : type and peer are required (is -target set?)")
+	}
+	pairs, err := parseMapping(mapping)
+	if err != nil {
+		return nil, err
+	}
+	return MatchFields(typ, peer, tagKey, pairs), nil
+}
+
 // returns true if the key exist and will overwrite
 func (c *Code) Store(key string, value interface{}) error {
 	_, has := c.keeper[key]
@@ -112,37 +144,18 @@ func (c *Code) AddToImports(imp string) string {
 	return ""
 }
 
-// check if a kind has a method called the same as the template being declared
-func (c *Code) Implements(fieldInfo TypeInfo) (bool, error) {
-	if c.CodeConfig.TemplateName == "" {
-		return false, errors.New("you haven't called Declare(methodName) to allow replacing existing generated code")
+// true if the type (or a pointer to it) implements the interface, e.g. `implements "fmt.Stringer" .`
+// The interface can be qualified by package name or path (e.g. `encoding/json.Marshaler`)
+func (c *Code) Implements(interfaceName string, typeInfo TypeInfo) (bool, error) {
+	typeName, err := c.PackageInfo.LookupType(interfaceName)
+	if err != nil {
+		return false, err
 	}
-	if fieldInfo.Package == "" {
-		nt, err := c.StructByKey(fieldInfo.Kind)
-		if nt == nil || err != nil {
-			log.Printf("lookup error : %v", err)
-			return false, err
-		}
-	} else {
-		if fieldInfo.PackagePath != "" {
-			log.Printf("package path : %q", fieldInfo.PackagePath)
-		}
-		log.Printf("we should load : %q and lookup for %q", fieldInfo.Package, fieldInfo.Kind)
-		// we have to load the package
-		loadedPackage, err := LoadPackage(fieldInfo.Package)
-		if err != nil {
-			log.Printf("load error : %v", err)
-			return false, err
-		}
-		codeBuilder := DefaultAnalyzer()
-		command := NewCommand(codeBuilder)
-		if err := command.Analyse(codeBuilder, loadedPackage); err != nil {
-			return false, fmt.Errorf("error analyzing package : %v", err)
-		}
-		//log.Printf("package loaded :\n %#v\n", command.Result)
+	iface, ok := typeName.Type().Underlying().(*types.Interface)
+	if !ok {
+		return false, fmt.Errorf("%q is not an interface", interfaceName)
 	}
-	// by default : assume it doens't implements
-	return false, nil
+	return typeInfo.Implements(iface), nil
 }
 
 // this should be called to allow the generator to know which kind of methods we're generating
@@ -156,13 +169,19 @@ func (c *Code) Declare(name string) error {
 	}
 	c.CodeConfig.TemplateName = name
 	c.keeper[name+c.CodeConfig.SelectedType] = "" // set it to empty in case of self reference, so template will exit
+	for _, selected := range c.CodeConfig.SelectedTypes {
+		c.keeper[name+selected] = "" // the other selected types are generated by the main template
+	}
+	for _, selected := range c.CodeConfig.runSelected {
+		c.keeper[name+selected] = "" // and so are the types selected in the other files of the run
+	}
 	return nil
 }
 
 // checker for recurse generated
 func (c *Code) HasNotGenerated(pkg, kind string) (bool, error) {
 	if c == nil {
-		return false, errors.New("impossible : code was not passed here (.Root missing ???)")
+		return false, errors.New("impossible : template is not bound to a code")
 	}
 	if c.CodeConfig.TemplateName == "" {
 		//log.Printf("you haven't called Declare(methodName) to allow replacing existing generated code")
@@ -172,22 +191,28 @@ func (c *Code) HasNotGenerated(pkg, kind string) (bool, error) {
 		//log.Printf("HasNotGenerated : empty package on kind %q", kind)
 		return false, nil
 	}
-	if pkg != c.PackageInfo.Name {
-		//log.Printf("HasNotGenerated : different packages %q != %q", pkg, c.PackageInfo.Name)
-		return false, nil
-	}
 	// check if we're going to allow call to RecurseGenerate (optim calls)
-	nt, err := c.StructByKey(kind)
-	if nt == nil || err != nil {
-		return false, err
-	}
-	if nt.IsImported {
-		//log.Printf("HasNotGenerated : %q in package %q it's maked imported", kind, pkg)
-		return false, nil
-	}
-	if nt.Package != pkg {
-		//log.Printf("HasNotGenerated : %q in package %q it's a different package %q", kind, pkg, nt.Package)
-		return false, nil
+	var nt *TypeInfo
+	var err error
+	if pkg != c.PackageInfo.Name && pkg != c.PackageInfo.Path {
+		// kinds of other packages are qualified by name, e.g. `model.User`
+		nt, err = c.TypeOf(pkg + "." + kind[strings.LastIndex(kind, ".")+1:])
+		if nt == nil || err != nil {
+			return false, err
+		}
+	} else {
+		nt, err = c.StructByKey(kind)
+		if nt == nil || err != nil {
+			return false, err
+		}
+		if nt.IsImported {
+			//log.Printf("HasNotGenerated : %q in package %q it's maked imported", kind, pkg)
+			return false, nil
+		}
+		if nt.Package != c.PackageInfo.Name {
+			//log.Printf("HasNotGenerated : %q in package %q it's a different package %q", kind, pkg, nt.Package)
+			return false, nil
+		}
 	}
 	if IsBasic(nt.Kind) {
 		//log.Printf("HasNotGenerated : call for basic kind %q", nt.Kind)
@@ -196,12 +221,17 @@ func (c *Code) HasNotGenerated(pkg, kind string) (bool, error) {
 	// finally we deliver result
 	entity := c.CodeConfig.TemplateName + kind
 	_, has := c.keeper[entity]
+	if _, recursed := c.CodeConfig.recursed[entity]; recursed {
+		has = true // written in another file of the run
+	}
 	//log.Printf("HasNotGenerated : %q %t", entity, has)
 	return !has, nil
 }
 
 // uses the template name to apply the template recursively
-// it's useful for replacing the code in existing generated files
+// it's useful for replacing the code in existing generated files.
+// Types of other packages (pkg is their name or path) can't have methods generated, but the template can
+// generate functions for them, e.g. `func encodeModelUser(v model.User)`
 func (c *Code) RecurseGenerate(pkg, kind string) error {
 	if c.CodeConfig.TemplateName == "" {
 		return errors.New("you haven't called Declare(methodName) to allow replacing existing generated code")
@@ -210,16 +240,38 @@ func (c *Code) RecurseGenerate(pkg, kind string) error {
 		log.Printf("RecurseGenerate : empty package on kind %q", kind)
 		return nil
 	}
-	if pkg != c.PackageInfo.Name {
-		log.Printf("RecurseGenerate : different packages %q != %q", pkg, c.PackageInfo.Name)
-		return nil
+	if pkg != c.PackageInfo.Name && pkg != c.PackageInfo.Path {
+		return c.recurseGenerate(kind, func() (*TypeInfo, error) {
+			// kinds of other packages are qualified by name, e.g. `model.User`
+			return c.TypeOf(pkg + "." + kind[strings.LastIndex(kind, ".")+1:])
+		})
 	}
+	return c.recurseGenerate(kind, func() (*TypeInfo, error) {
+		nt, err := c.StructByKey(kind)
+		if nt == nil || err != nil {
+			return nil, err
+		}
+		if nt.IsImported {
+			log.Printf("RecurseGenerate : %q in package %q it's imported", kind, pkg)
+			return nil, fmt.Errorf("RecurseGenerate : %q in package %q it's imported", kind, pkg)
+		}
+		if nt.Package != c.PackageInfo.Name {
+			log.Printf("RecurseGenerate : %q in package %q it's a different pacakge %q", kind, pkg, nt.Package)
+			return nil, fmt.Errorf("RecurseGenerate : %q in package %q it's a different package %q", kind, pkg, nt.Package)
+		}
+		return nt, nil
+	})
+}
+
+// applies the declared template to the type found by lookup, storing the result under kind
+func (c *Code) recurseGenerate(kind string, lookup func() (*TypeInfo, error)) error {
 	entity := c.CodeConfig.TemplateName + kind
 	if c.CodeConfig.DebugPrint {
 		log.Printf("RecurseGenerate : processing %q %q ", c.CodeConfig.TemplateName, kind)
 	}
-	// already has it
-	if _, has := c.keeper[entity]; has {
+	// already has it (or another file of the run has it)
+	_, recursed := c.CodeConfig.recursed[entity]
+	if _, has := c.keeper[entity]; has || recursed {
 		if c.CodeConfig.DebugPrint {
 			log.Printf("RecurseGenerate : %q already stored.", kind)
 		}
@@ -227,18 +279,10 @@ func (c *Code) RecurseGenerate(pkg, kind string) error {
 		return errors.New("RecurseGenerate : `" + kind + "` already stored. you are not checking that yourself?")
 	}
 
-	nt, err := c.StructByKey(kind)
+	nt, err := lookup()
 	if nt == nil || err != nil {
 		return err
 	}
-	if nt.IsImported {
-		log.Printf("RecurseGenerate : %q in package %q it's imported", kind, pkg)
-		return fmt.Errorf("RecurseGenerate : %q in package %q it's imported", kind, pkg)
-	}
-	if nt.Package != pkg {
-		log.Printf("RecurseGenerate : %q in package %q it's a different pacakge %q", kind, pkg, nt.Package)
-		return fmt.Errorf("RecurseGenerate : %q in package %q it's a different package %q", kind, pkg, nt.Package)
-	}
 	if IsBasic(nt.Kind) {
 		log.Printf("RecurseGenerate : call for basic kind %q", nt.Kind)
 		return errors.New("RecurseGenerate : don't recurse call for basic kind")
@@ -253,14 +297,34 @@ func (c *Code) RecurseGenerate(pkg, kind string) error {
 		return err
 	}
 	// everything went fine
-	c.keeper[entity] = buf.String()
+	c.keeper[entity] = RegionBegin + " " + c.CodeConfig.TemplateName + " " + kind + "\n" + buf.String() + "\n" + RegionEnd
+	if c.CodeConfig.recursed != nil {
+		c.CodeConfig.recursed[entity] = struct{}{}
+	}
 	//log.Printf("RecurseGenerate : %q for kind %q in package %q STORED", entity, nt.Kind, pkg)
 	return nil
 }
 
+// opens the region of the generated code for the type (regenerating replaces only the regions of an existing file)
+func (c *Code) RegionBegin(kind string) (string, error) {
+	if c.CodeConfig.TemplateName == "" {
+		return "", errors.New("you haven't called Declare(methodName) to name the region")
+	}
+	return RegionBegin + " " + c.CodeConfig.TemplateName + " " + kind, nil
+}
+
+func (c *Code) RegionEnd() string { return RegionEnd }
+
+// returns the stored code, sorted by key so the output is the same on every run
 func (c *Code) ListStored() []string {
+	keys := make([]string, 0, len(c.keeper))
+	for key := range c.keeper {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 	var result []string
-	for key, value := range c.keeper {
+	for _, key := range keys {
+		value := c.keeper[key]
 		if strings.HasPrefix(key, c.CodeConfig.TemplateName) {
 			if r, ok := value.(string); ok {
 				// len(0) is default template for main (
@@ -279,7 +343,11 @@ func (c *Code) ListStored() []string {
 }
 
 func (c *Code) Header(flagValues string) string {
-	return fmt.Sprintf("// Generated on %v by Stroo [https://github.com/badu/stroo]\n"+
-		"// Do NOT bother with altering it by hand : use the tool\n"+
-		"// Arguments at the time of generation:\n//\t%s", time.Now().Format("Mon Jan 2 15:04:05"), flagValues)
+	generated := "// Generated " + HeaderSignature + "\n"
+	if c.CodeConfig.Timestamp {
+		generated = fmt.Sprintf("// Generated on %v "+HeaderSignature+"\n", time.Now().Format("Mon Jan 2 15:04:05"))
+	}
+	return generated +
+		"// Do NOT bother with altering it by hand : use the tool\n" +
+		"// Arguments at the time of generation:\n//\t" + flagValues + "\n\n"
 }
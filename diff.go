@@ -0,0 +1,188 @@
+package stroo
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3 // lines of context around changes, like `diff -u`
+
+// one line of the edit script : ' ' kept, '-' removed from old, '+' added from new
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// splits keeping the lines without their terminator, noting if the last one is incomplete
+func diffLines(src string) []string {
+	if src == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(src, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// shortest edit script (Myers' algorithm, in linear space : the middle snake splits the problem in two halves)
+func editScript(old, new []string) []diffLine {
+	var result []diffLine
+	// common prefix and suffix are kept
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		result = append(result, diffLine{' ', old[prefix]})
+		prefix++
+	}
+	old, new = old[prefix:], new[prefix:]
+	suffix := 0
+	for suffix < len(old) && suffix < len(new) && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+	common := old[len(old)-suffix:]
+	old, new = old[:len(old)-suffix], new[:len(new)-suffix]
+	switch {
+	case len(old) == 0:
+		for _, line := range new {
+			result = append(result, diffLine{'+', line})
+		}
+	case len(new) == 0:
+		for _, line := range old {
+			result = append(result, diffLine{'-', line})
+		}
+	default:
+		x, y, u, v := middleSnake(old, new)
+		result = append(result, editScript(old[:x], new[:y])...)
+		for _, line := range old[x:u] {
+			result = append(result, diffLine{' ', line})
+		}
+		result = append(result, editScript(old[u:], new[v:])...)
+	}
+	for _, line := range common {
+		result = append(result, diffLine{' ', line})
+	}
+	return result
+}
+
+// the snake (from x, y to u, v) in the middle of the shortest edit script, found by going forward from the start
+// and backward from the end at the same time, until the paths meet
+func middleSnake(old, new []string) (int, int, int, int) {
+	n, m := len(old), len(new)
+	max := (n + m + 1) / 2
+	delta := n - m
+	odd := delta%2 != 0
+	offset := max + 1
+	// the furthest x reached on each diagonal k (x - y == k), going forward and going backward (from the end)
+	forward := make([]int, 2*max+3)
+	backward := make([]int, 2*max+3)
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			x := forward[offset+k-1] + 1
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && old[x] == new[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			// the backward diagonal which meets this one is delta - k
+			if reverse := delta - k; odd && reverse >= -(d-1) && reverse <= d-1 && x+backward[offset+reverse] >= n {
+				return startX, startY, x, y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			x := backward[offset+k-1] + 1
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && old[n-1-x] == new[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if reverse := delta - k; !odd && reverse >= -d && reverse <= d && x+forward[offset+reverse] >= n {
+				return n - x, m - y, n - startX, m - startY
+			}
+		}
+	}
+	return 0, 0, n, m // unreachable : the paths meet before
+}
+
+// UnifiedDiff returns the differences between old and new in unified format (empty if they are equal)
+func UnifiedDiff(oldName, newName string, old, new []byte) string {
+	if string(old) == string(new) {
+		return ""
+	}
+	script := editScript(diffLines(string(old)), diffLines(string(new)))
+
+	var sb strings.Builder
+	sb.WriteString("--- " + oldName + "\n")
+	sb.WriteString("+++ " + newName + "\n")
+	oldLine, newLine := 1, 1 // line numbers at script[idx]
+	for idx := 0; idx < len(script); {
+		if script[idx].op == ' ' {
+			oldLine++
+			newLine++
+			idx++
+			continue
+		}
+		// hunk starts with context before the change
+		start := idx
+		for start > 0 && idx-start < diffContext && script[start-1].op == ' ' {
+			start--
+		}
+		hunkOld, hunkNew := oldLine-(idx-start), newLine-(idx-start)
+		// extends while changes are closer than two contexts
+		end, kept := idx, 0
+		for end < len(script) && kept <= 2*diffContext {
+			if script[end].op == ' ' {
+				kept++
+			} else {
+				kept = 0
+			}
+			end++
+		}
+		if kept > diffContext {
+			end -= kept - diffContext
+		}
+		oldCount, newCount := 0, 0
+		var body strings.Builder
+		for _, line := range script[start:end] {
+			if line.op != '+' {
+				oldCount++
+			}
+			if line.op != '-' {
+				newCount++
+			}
+			body.WriteByte(line.op)
+			body.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		// like diff -u, an empty range starts at the line before
+		if oldCount == 0 {
+			hunkOld--
+		}
+		if newCount == 0 {
+			hunkNew--
+		}
+		sb.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", hunkOld, oldCount, hunkNew, newCount))
+		sb.WriteString(body.String())
+		for _, line := range script[idx:end] {
+			if line.op != '+' {
+				oldLine++
+			}
+			if line.op != '-' {
+				newLine++
+			}
+		}
+		idx = end
+	}
+	return sb.String()
+}
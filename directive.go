@@ -0,0 +1,100 @@
+package stroo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DirectivePrefix starts a generation request in the comment of a type e.g.
+// `//stroo:gen template=stringer.tmpl output=zz_string.go receiver=s`
+const DirectivePrefix = "//stroo:gen"
+
+// Directive is a generation request read from the comment of a type
+type Directive struct {
+	Template string            // template file, relative to the package directory
+	Output   string            // output file, relative to the package directory
+	Options  map[string]string // every key=value pair, including template and output
+}
+
+// reads all the `//stroo:gen` lines of the type's comment
+func (t *TypeInfo) Directives() ([]Directive, error) {
+	if t.Comment == nil {
+		return nil, nil
+	}
+	var result []Directive
+	for _, comment := range t.Comment.List {
+		if !strings.HasPrefix(comment.Text, DirectivePrefix) {
+			continue
+		}
+		line := strings.TrimPrefix(comment.Text, DirectivePrefix)
+		if line != "" && line[0] != ' ' && line[0] != '\t' {
+			continue // e.g. `//stroo:generate` is not ours
+		}
+		directive, err := ParseDirective(line)
+		if err != nil {
+			return nil, fmt.Errorf("type %q : %v", t.Name, err)
+		}
+		result = append(result, directive)
+	}
+	return result, nil
+}
+
+// parses the `key=value key2="quoted value"` part of a directive (template and output are mandatory)
+func ParseDirective(line string) (Directive, error) {
+	result := Directive{Options: make(map[string]string)}
+	line = strings.TrimSpace(line)
+	for line != "" {
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 || strings.ContainsAny(line[:eq], " \t\"") {
+			return result, fmt.Errorf("bad syntax for directive option in %q", line)
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			// scan to closing quote, skipping escaped quotes
+			i := 1
+			for i < len(line) && line[i] != '"' {
+				if line[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(line) {
+				return result, fmt.Errorf("unterminated quoted value for %q", key)
+			}
+			unquoted, err := strconv.Unquote(line[:i+1])
+			if err != nil {
+				return result, fmt.Errorf("bad quoted value for %q : %v", key, err)
+			}
+			value = unquoted
+			line = line[i+1:]
+			if line != "" && line[0] != ' ' && line[0] != '\t' {
+				return result, fmt.Errorf("missing space after value of %q", key)
+			}
+		} else {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			value = line[:end]
+			line = line[end:]
+		}
+		if _, has := result.Options[key]; has {
+			return result, fmt.Errorf("duplicate directive option %q", key)
+		}
+		result.Options[key] = value
+		line = strings.TrimSpace(line)
+	}
+	result.Template = result.Options["template"]
+	result.Output = result.Options["output"]
+	if result.Template == "" {
+		return result, fmt.Errorf("directive without template")
+	}
+	if result.Output == "" {
+		return result, fmt.Errorf("directive without output")
+	}
+	return result, nil
+}
@@ -1,17 +1,25 @@
 module github.com/badu/stroo
 
-go 1.13
+go 1.26.0
+
+require (
+	github.com/Masterminds/sprig v2.22.0+incompatible
+	github.com/gorilla/mux v1.7.3
+	github.com/rakyll/statik v0.1.6
+	golang.org/x/tools v0.50.0
+)
 
 require (
 	github.com/Masterminds/goutils v1.1.0 // indirect
 	github.com/Masterminds/semver v1.5.0 // indirect
-	github.com/Masterminds/sprig v2.22.0+incompatible
 	github.com/google/uuid v1.1.1 // indirect
-	github.com/gorilla/mux v1.7.3
 	github.com/huandu/xstrings v1.3.0 // indirect
 	github.com/imdario/mergo v0.3.8 // indirect
 	github.com/mitchellh/copystructure v1.0.0 // indirect
-	github.com/rakyll/statik v0.1.6
+	github.com/mitchellh/reflectwalk v1.0.0 // indirect
 	github.com/stretchr/testify v1.4.0 // indirect
-	golang.org/x/tools v0.0.0-20200213050514-49b8ac185c84
+	golang.org/x/crypto v0.57.0 // indirect
+	golang.org/x/mod v0.41.0 // indirect
+	golang.org/x/sync v0.23.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
 )
@@ -1,29 +1,58 @@
 package stroo
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
 	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/imports"
 	"log"
 	"os"
 )
 
 // loads one package
 func LoadPackage(path string) (*packages.Package, error) {
+	loadedPackages, err := LoadPackages(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(loadedPackages) > 1 {
+		for _, p := range loadedPackages {
+			log.Printf("Package: %q\n", p.ID)
+		}
+		return nil, fmt.Errorf("%d packages found. we're looking for exactly one", len(loadedPackages))
+	}
+	return loadedPackages[0], nil
+}
+
+// loads all the packages matching the patterns (e.g. `./...`) at once, so they share the type-checked graph
+func LoadPackages(patterns ...string) ([]*packages.Package, error) {
+	return loadPackages(context.Background(), "", patterns...)
+}
+
+// loads the packages, with the patterns relative to dir (current folder if empty)
+func loadPackages(ctx context.Context, dir string, patterns ...string) ([]*packages.Package, error) {
 	conf := packages.Config{
-		Mode:  packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax,
-		Tests: false, //TODO : decide if tests are useful
+		Context: ctx,
+		Dir:     dir,
+		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax,
+		Tests:   false, //TODO : decide if tests are useful
 	}
 
-	loadedPackage, err := packages.Load(&conf, path) //supports variadic multiple paths but we're using only one
+	loadedPackages, err := packages.Load(&conf, patterns...)
 	if err != nil {
-		log.Printf("error loading package %q : %v\n", path, err)
+		log.Printf("error loading packages %q : %v\n", patterns, err)
 		return nil, err
 	}
 	allErrors := ""
 	n := 0
-	packages.Visit(loadedPackage, nil, func(pkg *packages.Package) {
+	packages.Visit(loadedPackages, nil, func(pkg *packages.Package) {
 		for _, err := range pkg.Errors {
 			allErrors += err.Error() + "\n"
 			n++
@@ -36,18 +65,50 @@ func LoadPackage(path string) (*packages.Package, error) {
 		return nil, fmt.Errorf("%d error(s) encountered during load:\n%s", n, allErrors)
 	}
 
-	switch len(loadedPackage) {
-	case 0:
-		return nil, fmt.Errorf("%q matched no packages\n", path)
-	case 1:
-		// only allowed one
-	default:
-		for _, p := range loadedPackage {
-			log.Printf("Package: %q\n", p.ID)
+	if len(loadedPackages) == 0 {
+		return nil, fmt.Errorf("%q matched no packages\n", patterns)
+	}
+	return loadedPackages, nil
+}
+
+// flags which change how stroo runs, but not what it generates
+var runFlags = []string{"check", "debugPrint", "force", "serve", "testMode", "watch"}
+
+// the flags written in the header of generated files : run flags are left out, so checking
+// and generating produce the same output
+func generationFlags(analyzer *analysis.Analyzer) string {
+	result := ""
+	analyzer.Flags.VisitAll(func(f *flag.Flag) {
+		for _, name := range runFlags {
+			if f.Name == name {
+				return
+			}
 		}
-		return nil, fmt.Errorf("%d packages found. we're looking for exactly one", len(loadedPackage))
+		result += "-" + f.Name + "=" + f.Value.String() + " "
+	})
+	return result
+}
+
+// PostProcess is applied to everything generated (by the command and in playground) : the imports declared with
+// `addToImports` are merged into the import block, then goimports adds the missing ones, removes the unused ones and formats.
+// The file name tells goimports where to look for the packages
+func PostProcess(fileName string, src []byte, addedImports []string) ([]byte, error) {
+	fileSet := token.NewFileSet()
+	if file, err := parser.ParseFile(fileSet, fileName, src, parser.ParseComments); err == nil {
+		for _, imprt := range addedImports {
+			astutil.AddImport(fileSet, file, imprt)
+		}
+		var buf bytes.Buffer
+		if err := format.Node(&buf, fileSet, file); err != nil {
+			return nil, err
+		}
+		src = buf.Bytes()
+	} // else it's a fragment (no package clause) which goimports knows to handle
+	optImports, err := imports.Process(fileName, src, nil)
+	if err != nil {
+		return nil, err
 	}
-	return loadedPackage[0], nil
+	return format.Source(optImports)
 }
 
 // print the current configuration
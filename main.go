@@ -2,13 +2,17 @@ package stroo
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"go/ast"
-	"go/format"
+	"go/parser"
 	"go/token"
 	"go/types"
+	"io/fs"
+	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"reflect"
 	"sort"
@@ -31,41 +35,79 @@ const (
 	toolDoc  = "extracts declaration of a struct with it's methods"
 )
 
+// returned (wrapped) when the package has nothing to generate : multi package runs skip those packages
+var ErrNothingSelected = errors.New("no type was selected")
+
 type CodeConfig struct {
 	SelectedType     string
+	SelectedTypes    []string          // all the types that are processed in one template pass
+	Marker           string            // types having this text in their comments are processed
+	Directives       bool              // runs the generations requested by `//stroo:gen` comments
+	Options          map[string]string // key=value pairs of the `//stroo:gen` directive being processed
+	Force            bool              // overwrite output files which were not generated by stroo
+	Timestamp        bool              // header has the time of generation (output differs on every run)
+	Check            bool              // nothing is written : outputs which differ from the files on disk are reported
 	TestMode         bool
+	Watch            bool // keeps running, generating again when the go files or the templates change
 	DebugPrint       bool
 	Serve            bool
-	TemplateFile     string
+	TemplateFile     string // comma separated files, directories or globs
+	TemplatesDir     string // shared partials (e.g. `define` blocks) parsed along the template
+	EntryTemplate    string // name of the template which is executed (defaults to the first template file)
 	TemplateName     string // keeps the name that template declares (e.g. {{ declare "String" }}) used in recurse generation and list stored
 	OutputFile       string
-	SelectedPeerType string
+	SelectedPeerType string              // the type which is exposed to templates as `.Peer`, e.g. for generating converters
+	peer             *TypeInfo           // loaded from SelectedPeerType
+	runSelected      []string            // the types selected in the other files of the run, generated by the main template there
+	recursed         map[string]struct{} // declared name and kind of the types generated by recursion in the files of the run
 }
 
 type Command struct {
 	CodeConfig
-	Inspector  *analysis.Analyzer
-	WorkingDir string
-	Result     *PackageInfo
-	Out        bytes.Buffer
+	Inspector    *analysis.Analyzer
+	WorkingDir   string
+	Result       *PackageInfo
+	Out          bytes.Buffer
+	Outputs      []string // files generated (written, unless in test or check mode)
+	Stale        []string // in check mode, the outputs which differ from the files on disk
+	Templates    []string // template files which were parsed (builtin ones are left out), watched by -watch
+	manyPackages bool     // selected types can be in any of the packages : a type pattern may match nothing
+	unmatched    []string // the type patterns which matched nothing in all the packages (see Unmatched)
 }
 
 // builds a new command from the analyzer (which holds the inspector) and sets the Run function
 func NewCommand(analyzer *analysis.Analyzer) *Command {
+	result, err := newCommand(analyzer)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	return result
+}
+
+// same as NewCommand, but reporting errors instead of exiting
+func newCommand(analyzer *analysis.Analyzer) (*Command, error) {
 	workingDir, err := os.Getwd()
 	if err != nil {
-		log.Fatalf("could NOT get working dir : %v", err)
+		return nil, fmt.Errorf("could NOT get working dir : %v", err)
 	}
 	if len(analyzer.Requires) != 1 {
-		log.Fatalf("we require only inspectAlyzer - shouldn't happen")
+		return nil, errors.New("we require only inspectAlyzer - shouldn't happen")
 	}
 	result := Command{
 		CodeConfig: CodeConfig{
 			SelectedType:     analyzer.Flags.Lookup("type").Value.String(),
+			Marker:           analyzer.Flags.Lookup("marker").Value.String(),
+			Directives:       analyzer.Flags.Lookup("directives").Value.String() == "true",
+			Force:            analyzer.Flags.Lookup("force").Value.String() == "true",
+			Timestamp:        analyzer.Flags.Lookup("timestamp").Value.String() == "true",
+			Check:            analyzer.Flags.Lookup("check").Value.String() == "true",
 			TestMode:         analyzer.Flags.Lookup("testMode").Value.String() == "true",
+			Watch:            analyzer.Flags.Lookup("watch").Value.String() == "true",
 			DebugPrint:       analyzer.Flags.Lookup("debugPrint").Value.String() == "true",
 			Serve:            analyzer.Flags.Lookup("serve").Value.String() == "true",
 			TemplateFile:     analyzer.Flags.Lookup("template").Value.String(),
+			TemplatesDir:     analyzer.Flags.Lookup("templates-dir").Value.String(),
+			EntryTemplate:    analyzer.Flags.Lookup("entry").Value.String(),
 			OutputFile:       analyzer.Flags.Lookup("output").Value.String(),
 			SelectedPeerType: analyzer.Flags.Lookup("target").Value.String(),
 		},
@@ -73,7 +115,7 @@ func NewCommand(analyzer *analysis.Analyzer) *Command {
 		Inspector:  analyzer.Requires[0], // needed in Run of the Command
 	}
 	analyzer.Run = result.Run // set the Run function to the analyzer
-	return &result
+	return &result, nil
 }
 
 func DefaultAnalyzer() *analysis.Analyzer {
@@ -96,11 +138,19 @@ func DefaultAnalyzer() *analysis.Analyzer {
 		ResultType:       reflect.TypeOf(new(PackageInfo)),
 	}
 	result.Flags.Bool("serve", false, "serve the playground, to help you build templates")
-	result.Flags.String("type", "", "type that should be processed e.g. SomeJsonPayload")
-	result.Flags.String("output", "", "name of the output file e.g. json_gen.go")
-	result.Flags.String("template", "", "name of the template file e.g. ./../templates/")
-	result.Flags.String("target", "", "name of the peer struct e.g. ./../testdata/pkg/model_b/SomeProtoBufPayload")
+	result.Flags.String("type", "", "type(s) that should be processed e.g. SomeJsonPayload or A,B,C or *Request")
+	result.Flags.String("marker", "", "process every type having this text in it's comment e.g. stroo:json")
+	result.Flags.Bool("directives", false, "run every generation requested by `//stroo:gen template=... output=...` type comments")
+	result.Flags.String("output", "", "name of the output file e.g. json_gen.go or one file per type e.g. {{.Kind | snakecase}}_gen.go")
+	result.Flags.String("template", "", "template file(s), directory or glob e.g. ./../templates/stringer.tmpl or a.tmpl,b.tmpl or ./../templates/json/")
+	result.Flags.String("templates-dir", "", "directory with shared templates (partials) e.g. ./../templates/partials")
+	result.Flags.String("entry", "", "name of the template to execute, when there are more (defaults to the first file) e.g. json.tmpl")
+	result.Flags.String("target", "", "peer type, available to templates as .Peer e.g. ./../testdata/pkg/model_b/SomeProtoBufPayload or github.com/x/pb.Payload")
+	result.Flags.Bool("force", false, "overwrite output files which don't have the stroo header")
+	result.Flags.Bool("timestamp", false, "write the time of generation in the header")
+	result.Flags.Bool("check", false, "write nothing, print the diff and fail if generated files are stale (for CI)")
 	result.Flags.Bool("testMode", false, "is in test mode : just display the result")
+	result.Flags.Bool("watch", false, "keep running and generate again when the go files or the templates change")
 	result.Flags.Bool("debugPrint", false, "print debugging info")
 	result.Flags.Usage = func() {
 		descMultiline := strings.Split(toolDoc, "\n\n")
@@ -128,14 +178,20 @@ func (c *Command) Run(pass *analysis.Pass) (interface{}, error) {
 		Path:       pass.Pkg.Path(),
 		PrintDebug: c.DebugPrint,
 	}
+	if len(pass.Files) > 0 {
+		result.Dir = filepath.Dir(pass.Fset.File(pass.Files[0].Pos()).Name())
+	}
 	inspResult, ok := pass.ResultOf[c.Inspector].(*inspector.Inspector)
 	if !ok {
-		log.Fatalf("Inspector is not (*inspector.Inspector)")
+		return nil, errors.New("inspector is not (*inspector.Inspector)")
 	}
 	result.LoadImports(pass.Pkg.Imports())
 	result.TypesInfo = pass.TypesInfo // exposed just in case someone wants to get wild
+	result.typesPkg = pass.Pkg
+	result.fset = pass.Fset
 	//log.Printf("Package info: %q path %q", pass.Pkg.Name(), pass.Pkg.Path())
 	var discoveredFuncs Methods
+	enums := make(map[string]Consts)
 
 	inspResult.Preorder(nodeFilter, func(node ast.Node) {
 		if err != nil {
@@ -144,7 +200,7 @@ func (c *Command) Run(pass *analysis.Pass) (interface{}, error) {
 		}
 		switch nodeType := node.(type) {
 		case *ast.FuncDecl:
-			if fnInfo, infoErr := readFuncDecl(nodeType); infoErr == nil {
+			if fnInfo, infoErr := readFuncDecl(pass.Pkg, pass.Fset, pass.TypesInfo, nodeType); infoErr == nil {
 				fnInfo.Package = pass.Pkg.Name()
 				fnInfo.PackagePath = pass.Pkg.Path()
 				discoveredFuncs = append(discoveredFuncs, *fnInfo)
@@ -152,103 +208,47 @@ func (c *Command) Run(pass *analysis.Pass) (interface{}, error) {
 		case *ast.GenDecl:
 			switch nodeType.Tok {
 			case token.TYPE:
+				// same as for values, the doc of the block belongs to it's spec only when there is one
+				var doc *ast.CommentGroup
+				if len(nodeType.Specs) == 1 {
+					doc = nodeType.Doc
+				}
 				for _, spec := range nodeType.Specs {
 					typeSpec := spec.(*ast.TypeSpec)
 					if typeSpec.Name == nil {
-						log.Fatalf("type spec has name nil : %#v", typeSpec)
+						err = fmt.Errorf("type spec has name nil : %#v", typeSpec)
+						return
 					}
-					switch typedType := typeSpec.Type.(type) {
-					case *ast.InterfaceType:
+					typeInfo, infoErr := readType(pass.Pkg, pass.Fset, pass.TypesInfo, typeSpec, doc)
+					if infoErr != nil {
+						log.Printf("error reading type : %v", infoErr)
+						err = infoErr
+						continue
+					}
+					result.Types = append(result.Types, typeInfo)
+					if typeInfo.IsInterface {
 						// e.g. `type Intf interface{}`
-						typeInfo, infoErr := readType(pass.Pkg, typeSpec, nodeType.Doc)
-						if infoErr == nil {
-							result.Types = append(result.Types, typeInfo)
-							result.Interfaces = append(result.Interfaces, typeInfo)
-						} else {
-							log.Printf("error reading interface : %v", infoErr)
-							err = infoErr
-						}
-					case *ast.ArrayType:
-						// e.g. `type Array []string`
-						typeInfo, infoErr := readType(pass.Pkg, typeSpec, nodeType.Doc)
-						if infoErr == nil {
-							result.Types = append(result.Types, typeInfo)
-						} else {
-							log.Printf("error reading array : %v", infoErr)
-							err = infoErr
-						}
-					case *ast.StructType:
-						// e.g. `type Stru struct {}`
-						typeInfo, infoErr := readType(pass.Pkg, typeSpec, nodeType.Doc)
-						if infoErr == nil {
-							if fixErr := fixFieldsInfo(result.TypesInfo, typeInfo); fixErr == nil {
-								result.Types = append(result.Types, typeInfo)
-							} else {
-								log.Printf("error fixing struct : %v", fixErr)
-								err = fixErr
-							}
-						} else {
-							log.Printf("error reading struct : %v", infoErr)
-							err = infoErr
-						}
-					case *ast.Ident:
-						// e.g. : `type String string`
-						fieldInfo, infoErr := readIdent(typedType, nodeType.Doc)
-						if infoErr == nil {
-							typeInfo := NewAliasFromField(pass.Pkg, fieldInfo, typeSpec.Name.Name)
-							result.Types = append(result.Types, typeInfo)
-						} else {
-							log.Printf("error reading ident : %v", infoErr)
-							err = infoErr
-						}
-					case *ast.SelectorExpr:
-						// e.g. : `type Timer time.Ticker`
-						fieldInfo, infoErr := readSelector(typedType, nodeType.Doc)
-						if infoErr == nil {
-							typeInfo := NewAliasFromField(pass.Pkg, fieldInfo, typeSpec.Name.Name)
-							result.Types = append(result.Types, typeInfo)
-						} else {
-							log.Printf("error reading selector : %v", infoErr)
-							err = infoErr
-						}
-					case *ast.StarExpr:
-						// e.g. : `type Timer *time.Ticker`
-						fieldInfo, infoErr := readPointer(typedType, nodeType.Doc)
-						if infoErr == nil {
-							typeInfo := NewAliasFromField(pass.Pkg, fieldInfo, typeSpec.Name.Name)
-							result.Types = append(result.Types, typeInfo)
-						} else {
-							log.Printf("error reading pointer : %v", infoErr)
-							err = infoErr
-						}
-					case *ast.FuncType:
-						// e.g. `type encoderFunc func(e *encodeState, v reflect.Value, opts encOpts)`
-						// convention, the type will have the first method describing the params and returns
-						typeInfo, infoErr := readType(pass.Pkg, typeSpec, nodeType.Doc)
-						if infoErr == nil {
-							if fixErr := fixFieldsInfo(result.TypesInfo, typeInfo); fixErr == nil {
-								typeInfo.IsFunc = true
-								result.Types = append(result.Types, typeInfo)
-							} else {
-								log.Printf("error fixing func type : %v", fixErr)
-								err = fixErr
-							}
-						} else {
-							log.Printf("error reading func type : %v", infoErr)
-							err = infoErr
-						}
-					default:
-						log.Printf("have you modified the filter ? Unhandled : %#v\n", typedType)
+						result.Interfaces = append(result.Interfaces, typeInfo)
 					}
 				}
 			case token.VAR, token.CONST:
-				for _, spec := range nodeType.Specs {
+				// the doc of the block belongs to it's spec only when there is one
+				var doc *ast.CommentGroup
+				if len(nodeType.Specs) == 1 {
+					doc = nodeType.Doc
+				}
+				for specIdx, spec := range nodeType.Specs {
 					switch vl := spec.(type) {
 					case *ast.ValueSpec:
+						if nodeType.Tok == token.CONST {
+							for typeName, consts := range readConsts(pass.Pkg, pass.Fset, pass.TypesInfo, vl, specIdx, doc) {
+								enums[typeName] = append(enums[typeName], consts...)
+							}
+						}
 						if len(vl.Names) > 0 {
 							def := result.TypesInfo.Defs[vl.Names[0]]
 							if def != nil {
-								if results, infoErr := readValue(def, vl); infoErr == nil {
+								if results, infoErr := readValue(pass.Fset, def, vl, doc); infoErr == nil {
 									result.Vars = append(result.Vars, results...)
 								} else {
 									log.Printf("error reading variable/constant : %v", infoErr)
@@ -266,44 +266,28 @@ func (c *Command) Run(pass *analysis.Pass) (interface{}, error) {
 		}
 	})
 
+	// attaching constants to their types
+	for idx := range result.Types {
+		if consts, has := enums[result.Types[idx].Name]; has {
+			result.Types[idx].Consts = markDuplicates(consts)
+		}
+	}
+
 	// fixing funcs (methods versus normal funcs)
 	for _, fn := range discoveredFuncs {
-		// fix variable types
-		for idx := range fn.Params {
-			for _, varType := range result.Types {
-				if varType.Kind == result.Vars[idx].Kind {
-					result.Vars[idx].Type = &varType
-					break
-				}
-				if varType.Name == result.Vars[idx].Kind {
-					result.Vars[idx].Type = &varType
-					break
-				}
-			}
-		}
-		// fix variable types
-		for idx := range fn.Returns {
-			for _, varType := range result.Types {
-				if varType.Kind == result.Vars[idx].Kind {
-					result.Vars[idx].Type = &varType
-					break
-				}
-				if varType.Name == result.Vars[idx].Kind {
-					result.Vars[idx].Type = &varType
-					break
-				}
-			}
-		}
+		// point params and returns to the declarations of their kinds
+		resolveVars(result.Types, fn.Params)
+		resolveVars(result.Types, fn.Returns)
 		// doesn't have a receiver : normal function
 		if fn.ReceiverType == "" {
 			result.Functions = append(result.Functions, fn)
 			continue
 		}
 
-		// look into structs and attach if found
-		for _, receiverType := range result.Types {
-			if receiverType.Kind == fn.ReceiverType {
-				receiverType.MethodList = append(receiverType.MethodList, fn)
+		// look into types and attach if found
+		for idx := range result.Types {
+			if result.Types[idx].Name == fn.ReceiverType {
+				result.Types[idx].MethodList = append(result.Types[idx].MethodList, fn)
 				break
 			}
 		}
@@ -335,32 +319,8 @@ func (c *Command) Run(pass *analysis.Pass) (interface{}, error) {
 			log.Printf("error : func type decl should have exactly one method")
 			continue
 		}
-
-		for paramIdx := range result.Types[idx].MethodList[0].Params {
-			for _, varType := range result.Types {
-				if varType.Kind == result.Types[idx].MethodList[0].Params[paramIdx].Kind {
-					result.Types[idx].MethodList[0].Params[paramIdx].Type = &varType
-					break
-				}
-				if varType.Name == result.Types[idx].MethodList[0].Params[paramIdx].Kind {
-					result.Types[idx].MethodList[0].Params[paramIdx].Type = &varType
-					break
-				}
-			}
-		}
-
-		for returnIdx := range result.Types[idx].MethodList[0].Returns {
-			for _, varType := range result.Types {
-				if varType.Kind == result.Types[idx].MethodList[0].Returns[returnIdx].Kind {
-					result.Types[idx].MethodList[0].Returns[returnIdx].Type = &varType
-					break
-				}
-				if varType.Name == result.Types[idx].MethodList[0].Returns[returnIdx].Kind {
-					result.Types[idx].MethodList[0].Returns[returnIdx].Type = &varType
-					break
-				}
-			}
-		}
+		resolveVars(result.Types, result.Types[idx].MethodList[0].Params)
+		resolveVars(result.Types, result.Types[idx].MethodList[0].Returns)
 	}
 
 	return result, err
@@ -413,19 +373,374 @@ func (c *Command) Analyse(analyzer *analysis.Analyzer, loadedPackage *packages.P
 }
 
 func (c *Command) Generate(analyzer *analysis.Analyzer) error {
-	templatePath, err := filepath.Abs(c.TemplateFile)
+	tmpl, files, err := parseTemplates(c.TemplateFile, c.TemplatesDir, c.EntryTemplate)
+	c.Templates = append(c.Templates, files...)
 	if err != nil {
 		return err
 	}
-	if _, err := os.Stat(templatePath); os.IsNotExist(err) {
-		return fmt.Errorf("template-error : %v ; path = %q", err, templatePath)
-	}
-	tmpl, err := template.New(filepath.Base(templatePath)).Funcs(DefaultFuncMap()).ParseFiles(templatePath)
+
+	selected, err := c.SelectTypes()
 	if err != nil {
-		return fmt.Errorf("template-parse-error : %v ; path = %q", err, templatePath)
+		return err
+	}
+
+	config := c.CodeConfig
+	// files of one run don't write the types generated by recursion more than once
+	config.recursed = make(map[string]struct{})
+	if config.SelectedPeerType != "" {
+		config.peer, err = c.loadPeer(config.SelectedPeerType, c.WorkingDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	// one file per type, e.g. `-output={{.Kind | snakecase}}_gen.go`
+	if strings.Contains(c.OutputFile, "{{") {
+		outputTmpl, err := template.New("output").Funcs(DefaultFuncMap()).Parse(c.OutputFile)
+		if err != nil {
+			return fmt.Errorf("output-parse-error : %v ; output = %q", err, c.OutputFile)
+		}
+		for _, selectedType := range selected {
+			config.runSelected = append(config.runSelected, selectedType.Name)
+		}
+		for _, selectedType := range selected {
+			var outputName strings.Builder
+			if err := outputTmpl.Execute(&outputName, selectedType); err != nil {
+				return fmt.Errorf("output-error : %v ; output = %q", err, c.OutputFile)
+			}
+			if err := c.generateFile(analyzer, tmpl, config, TypesSlice{selectedType}, outputName.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// all types in one file
+	return c.generateFile(analyzer, tmpl, config, selected, c.OutputFile)
+}
+
+// runs every generation requested by `//stroo:gen` directives found in the comments of the types.
+// Types asking for the same template, output and options are rendered in one template pass, into one file
+func (c *Command) GenerateDirectives(analyzer *analysis.Analyzer) error {
+	if c.Result == nil {
+		return errors.New("error : package was not analysed")
+	}
+	type request struct {
+		Directive
+		selected TypesSlice
+	}
+	var requests []*request
+	byOutput := make(map[string]*request)
+	for _, typeInfo := range c.Result.Types {
+		directives, err := typeInfo.Directives()
+		if err != nil {
+			return err
+		}
+		for _, directive := range directives {
+			existing, has := byOutput[directive.Output]
+			if !has {
+				existing = &request{Directive: directive}
+				byOutput[directive.Output] = existing
+				requests = append(requests, existing)
+			} else if !reflect.DeepEqual(existing.Options, directive.Options) {
+				return fmt.Errorf("type %q : output %q is requested with different template or options", typeInfo.Name, directive.Output)
+			}
+			existing.selected = append(existing.selected, typeInfo)
+		}
+	}
+	if len(requests) == 0 {
+		return fmt.Errorf("no `%s` directive found : %w", DirectivePrefix, ErrNothingSelected)
+	}
+	// the types selected with the same template, generated by the main template of their file
+	runSelected := make(map[string][]string)
+	for _, req := range requests {
+		key := req.Template + "|" + req.Options["entry"]
+		for _, typeInfo := range req.selected {
+			runSelected[key] = append(runSelected[key], typeInfo.Name)
+		}
+	}
+	recursed := make(map[string]struct{})
+	templates := make(map[string]*template.Template)
+	for _, req := range requests {
+		var templateFiles []string
+		for _, templateFile := range strings.Split(req.Template, ",") {
+			templateFiles = append(templateFiles, c.inPackageDir(strings.TrimSpace(templateFile)))
+		}
+		templateFile := strings.Join(templateFiles, ",")
+		entry := req.Options["entry"]
+		tmpl, has := templates[templateFile+"|"+entry]
+		if !has {
+			var (
+				files []string
+				err   error
+			)
+			tmpl, files, err = parseTemplates(templateFile, c.TemplatesDir, entry)
+			c.Templates = append(c.Templates, files...)
+			if err != nil {
+				return err
+			}
+			templates[templateFile+"|"+entry] = tmpl
+		}
+		config := c.CodeConfig
+		config.TemplateFile = templateFile
+		config.Options = req.Options
+		config.runSelected = runSelected[req.Template+"|"+entry]
+		config.recursed = recursed
+		if target, has := req.Options["target"]; has {
+			peer, err := c.loadPeer(target, c.inPackageDir("."))
+			if err != nil {
+				return err
+			}
+			config.SelectedPeerType, config.peer = target, peer
+		}
+		if err := c.generateFile(analyzer, tmpl, config, req.selected, c.inPackageDir(req.Output)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PackageReport tells what was generated for one of the packages of a multi package run
+type PackageReport struct {
+	Path    string
+	Outputs []string // files generated for the package
+	Stale   []string // in check mode, outputs which are not up to date
+	Skipped bool     // nothing was selected in this package
+	Err     error
+}
+
+// analyses and generates every loaded package (e.g. `stroo ./...`) in parallel.
+// The reports come in the order of the packages and everything generated is appended to Out
+func (c *Command) GenerateAll(analyzer *analysis.Analyzer, loadedPackages []*packages.Package) []PackageReport {
+	reports := make([]PackageReport, len(loadedPackages))
+	commands := make([]*Command, len(loadedPackages))
+	var wg sync.WaitGroup
+	for idx, loadedPackage := range loadedPackages {
+		commands[idx] = &Command{
+			CodeConfig:   c.CodeConfig,
+			Inspector:    c.Inspector,
+			WorkingDir:   c.WorkingDir,
+			manyPackages: len(loadedPackages) > 1,
+		}
+		wg.Add(1)
+		go func(command *Command, report *PackageReport, loadedPackage *packages.Package) {
+			defer wg.Done()
+			report.Path = loadedPackage.PkgPath
+			if err := command.Analyse(analyzer, loadedPackage); err != nil {
+				report.Err = err
+				return
+			}
+			var err error
+			if command.Directives {
+				err = command.GenerateDirectives(analyzer)
+			} else {
+				err = command.Generate(analyzer)
+			}
+			switch {
+			case errors.Is(err, ErrNothingSelected):
+				report.Skipped = true
+			case err != nil:
+				report.Err = err
+			}
+			report.Outputs = command.Outputs
+			report.Stale = command.Stale
+		}(commands[idx], &reports[idx], loadedPackage)
+	}
+	wg.Wait()
+	for _, command := range commands {
+		c.Out.Write(command.Out.Bytes())
+		c.Outputs = append(c.Outputs, command.Outputs...)
+		c.Stale = append(c.Stale, command.Stale...)
+		c.Templates = append(c.Templates, command.Templates...)
+	}
+	c.unmatched = nil
+	if len(commands) > 1 && !c.Directives {
+		c.unmatched = unmatchedTypes(c.SelectedType, commands)
+	}
+	return reports
+}
+
+// the error for the type names or patterns of the last GenerateAll which matched nothing in all the packages
+// (a single package reports them as it's own error)
+func (c *Command) Unmatched() error {
+	if len(c.unmatched) == 0 {
+		return nil
+	}
+	return fmt.Errorf("no type matches %q in the packages", strings.Join(c.unmatched, ","))
+}
+
+// the patterns of selectedTypes (comma separated) which match no type of the analysed packages
+func unmatchedTypes(selectedTypes string, commands []*Command) []string {
+	var result []string
+	for _, pattern := range strings.Split(selectedTypes, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		found := false
+		for _, command := range commands {
+			if command.Result == nil {
+				continue
+			}
+			for _, typeInfo := range command.Result.Types {
+				if matched, _ := path.Match(pattern, typeInfo.Name); matched {
+					found = true
+				}
+			}
+		}
+		if !found {
+			result = append(result, pattern)
+		}
+	}
+	return result
+}
+
+// outputs and directives are relative to the package they live in
+func (c *Command) inPackageDir(name string) string {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, BuiltinPrefix) {
+		return name
+	}
+	if c.Result == nil || c.Result.Dir == "" {
+		return filepath.Join(c.WorkingDir, name)
 	}
+	return filepath.Join(c.Result.Dir, name)
+}
+
+// parses the templates (comma separated files, directories or globs) and the partials found in the templates dir.
+// Returns the entry template, which by default is the first file
+func parseTemplates(templateFiles, templatesDir, entry string) (*template.Template, []string, error) {
+	var files []string
+	for _, pattern := range strings.Split(templateFiles, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		found, err := findTemplates(pattern)
+		if err != nil {
+			return nil, files, err
+		}
+		files = append(files, found...)
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("template-error : no template in %q", templateFiles)
+	}
+	if entry == "" {
+		entry = filepath.Base(files[0])
+		if strings.HasPrefix(files[0], BuiltinPrefix) {
+			entry = builtinFile(files[0])
+		}
+	}
+	if templatesDir != "" {
+		partials, err := findTemplates(templatesDir)
+		if err != nil {
+			return nil, files, err
+		}
+		files = append(files, partials...)
+	}
+	// a file given twice (e.g. the partials dir holds the entry) is parsed once
+	seen := make(map[string]struct{})
+	var uniqueFiles []string
+	for _, file := range files {
+		if _, has := seen[file]; !has {
+			seen[file] = struct{}{}
+			uniqueFiles = append(uniqueFiles, file)
+		}
+	}
+	// templates are named by their file name : a second file with the same name would silently replace the first
+	byName := make(map[string]string)
+	for _, file := range uniqueFiles {
+		name := filepath.Base(file)
+		if strings.HasPrefix(file, BuiltinPrefix) {
+			name = builtinFile(file)
+		}
+		if other, has := byName[name]; has {
+			return nil, files, fmt.Errorf("template-error : %q and %q have the same name %q", other, file, name)
+		}
+		byName[name] = file
+	}
+	// builtin templates are parsed first, so the files can redefine their blocks
+	var builtins, osFiles []string
+	for _, file := range uniqueFiles {
+		if strings.HasPrefix(file, BuiltinPrefix) {
+			builtins = append(builtins, path.Join(builtinDir, builtinFile(file)))
+		} else {
+			osFiles = append(osFiles, file)
+		}
+	}
+	tmpl := template.New(entry).Funcs(DefaultFuncMap())
+	if len(builtins) > 0 {
+		if _, err := tmpl.ParseFS(builtinTemplates, builtins...); err != nil {
+			return nil, osFiles, fmt.Errorf("template-parse-error : %v ; files = %q", err, builtins)
+		}
+	}
+	if len(osFiles) > 0 {
+		if _, err := tmpl.ParseFiles(osFiles...); err != nil {
+			return nil, osFiles, fmt.Errorf("template-parse-error : %v ; files = %q", err, osFiles)
+		}
+	}
+	result := tmpl.Lookup(entry)
+	if result == nil || result.Tree == nil {
+		return nil, osFiles, fmt.Errorf("template-error : entry template %q not found in %q", entry, uniqueFiles)
+	}
+	return result, osFiles, nil
+}
+
+// a template file, all the templates of a directory or the files matching a glob
+func findTemplates(pattern string) ([]string, error) {
+	if strings.HasPrefix(pattern, BuiltinPrefix) {
+		if _, err := fs.Stat(builtinTemplates, path.Join(builtinDir, builtinFile(pattern))); err != nil {
+			return nil, fmt.Errorf("template-error : there is no %q (see `stroo templates list`)", pattern)
+		}
+		return []string{pattern}, nil
+	}
+	var result []string
+	if strings.ContainsAny(pattern, "*?[") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("template-error : %v ; pattern = %q", err, pattern)
+		}
+		result = matches
+	} else {
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("template-error : %v ; path = %q", err, pattern)
+		}
+		if !info.IsDir() {
+			result = []string{pattern}
+		} else {
+			for _, extension := range []string{"*.tmpl", "*.tpl"} {
+				matches, err := filepath.Glob(filepath.Join(pattern, extension))
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, matches...)
+			}
+			sort.Strings(result)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("template-error : no template found in %q", pattern)
+	}
+	for idx, file := range result {
+		absolute, err := filepath.Abs(file)
+		if err != nil {
+			return nil, err
+		}
+		result[idx] = absolute
+	}
+	return result, nil
+}
+
+// applies the template over the selected types and writes the result into the output file
+func (c *Command) generateFile(analyzer *analysis.Analyzer, tmpl *template.Template, config CodeConfig, selected TypesSlice, outputFile string) error {
+	config.SelectedTypes = nil
+	for _, selectedType := range selected {
+		config.SelectedTypes = append(config.SelectedTypes, selectedType.Name)
+	}
+	config.SelectedType = config.SelectedTypes[0] // templates handling a single type
+	config.OutputFile = outputFile
 
-	result, err := New(c.Result, c.CodeConfig, tmpl)
+	result, err := New(c.Result, config, tmpl)
 	if err != nil {
 		return fmt.Errorf("error-building-code : %v", err)
 	}
@@ -433,41 +748,118 @@ func (c *Command) Generate(analyzer *analysis.Analyzer) error {
 
 	var buf bytes.Buffer
 	if err := result.Tmpl().Execute(&buf, &result); err != nil {
-		return fmt.Errorf("failed to parse template %s: %s\nPartial result:\n%s", c.TemplateFile, err, buf.String())
+		return fmt.Errorf("failed to parse template %s: %s\nPartial result:\n%s", config.TemplateFile, err, buf.String())
 	}
 
 	// forced add header
 	var src []byte
-	src = append(src, result.Header(Print(analyzer, false))...)
+	src = append(src, result.Header(generationFlags(analyzer))...)
+	// templates may leave the package clause out
+	if _, err := parser.ParseFile(token.NewFileSet(), "", buf.Bytes(), parser.PackageClauseOnly); err != nil {
+		src = append(src, "package "+c.Result.Name+"\n\n"...)
+	}
 	src = append(src, buf.Bytes()...)
-	// format the source
-	formatted, err := format.Source(src)
+	outputFile = c.inPackageDir(outputFile)
+	// imports and format, same as the playground
+	formatted, err := PostProcess(outputFile, src, result.Imports)
 	if err != nil {
 		return fmt.Errorf("go/format error: %v\nGo source:\n%s", err, src)
 	}
-	c.Out.Write(formatted)
+	formatted, err = wrapLoose(formatted, result.CodeConfig.TemplateName)
+	if err != nil {
+		return fmt.Errorf("error wrapping the code outside regions : %v", err)
+	}
+	c.Outputs = append(c.Outputs, outputFile)
 	// if it's `testmode`, print and exit (same as playground, but in terminal)
 	if c.TestMode {
+		c.Out.Write(formatted)
 		return nil
 	}
-	// TODO : if file exists, overwrite only the generated part - template should announce the intention of generator e.g. will write methods with signature "String() string" for the struct named "<struct_name>"
-	/**
-	if _, err := os.Stat(*OutputFile); !os.IsNotExist(err) {
-		log.Fatalf("destination exists = %q", *OutputFile)
+	// if file exists, overwrite only the generated regions (see `regionBegin`)
+	existing, err := ioutil.ReadFile(outputFile)
+	if err == nil {
+		formatted, err = MergeGenerated(existing, formatted, result.CodeConfig.TemplateName, c.Force)
+		if errors.Is(err, ErrNotGenerated) {
+			return fmt.Errorf("refusing to overwrite %s : %w (use -force)", outputFile, err)
+		}
+		if err != nil {
+			return fmt.Errorf("error merging into %s : %w", outputFile, err)
+		}
+		// the merged regions might have made imports of the kept code unused (or the reverse)
+		formatted, err = PostProcess(outputFile, formatted, nil)
+		if err != nil {
+			return fmt.Errorf("error merging into %s : %w", outputFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("error reading existing file : %v", err)
 	}
-	**/
-	log.Printf("Creating %s/%s\n", c.WorkingDir, c.OutputFile)
-	file, err := os.Create(c.WorkingDir + "/" + c.OutputFile)
-	if err != nil {
-		return fmt.Errorf("error creating file : %v", err)
+	// in check mode, the diff is the output
+	if c.Check {
+		if diff := UnifiedDiff(outputFile, outputFile+" (generated)", existing, formatted); diff != "" {
+			c.Stale = append(c.Stale, outputFile)
+			c.Out.WriteString(diff)
+		}
+		return nil
 	}
-	// go ahead and write the file
-	if _, err := file.Write(formatted); err != nil {
+	c.Out.Write(formatted)
+	log.Printf("Creating %s\n", outputFile)
+	if err := ioutil.WriteFile(outputFile, formatted, 0644); err != nil {
 		return fmt.Errorf("error writing to file : %v", err)
 	}
 	return nil
 }
 
+// returns the types selected by the `type` flag (comma separated names or glob patterns)
+// and the types which have the `marker` in their comments
+func (c *Command) SelectTypes() (TypesSlice, error) {
+	if c.Result == nil {
+		return nil, errors.New("error : package was not analysed")
+	}
+	var result TypesSlice
+	seen := make(map[string]struct{})
+	add := func(typeInfo TypeInfo) {
+		if _, has := seen[typeInfo.Name]; has {
+			return
+		}
+		seen[typeInfo.Name] = struct{}{}
+		result = append(result, typeInfo)
+	}
+	if c.SelectedType != "" {
+		for _, pattern := range strings.Split(c.SelectedType, ",") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+			found := false
+			for _, typeInfo := range c.Result.Types {
+				matched, err := path.Match(pattern, typeInfo.Name)
+				if err != nil {
+					return nil, fmt.Errorf("bad type pattern %q : %v", pattern, err)
+				}
+				if matched {
+					found = true
+					add(typeInfo)
+				}
+			}
+			if !found && !c.manyPackages {
+				// a misspelled name is an error, not a package where there is nothing to generate
+				return nil, fmt.Errorf("no type matches %q", pattern)
+			}
+		}
+	}
+	if c.Marker != "" {
+		for _, typeInfo := range c.Result.Types {
+			if typeInfo.HasMarker(c.Marker) {
+				add(typeInfo)
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, ErrNothingSelected
+	}
+	return result, nil
+}
+
 func contains(args ...string) bool {
 	who := args[0]
 	for i := 1; i < len(args); i++ {
@@ -514,130 +906,33 @@ func isNil(value interface{}) bool {
 	return false
 }
 
-func DefaultFuncMap() template.FuncMap {
+// functions which don't need the code
+func commonFuncMap() template.FuncMap {
 	result := template.FuncMap{
 		"in":            contains,
 		"nil":           isNil,
 		"lowerInitial":  lowerInitial,
 		"capitalize":    capitalize,
 		"templateGoStr": templateGoStr,
-		"sort": func(fields TypesSlice) error {
-			sort.Sort(fields)
-			return nil
+		// sorting returns sorted copies : the analysis is shared by the generations running at the same time
+		"sort": func(fields TypesSlice) TypesSlice {
+			result := append(TypesSlice(nil), fields...)
+			sort.Sort(result)
+			return result
 		}, // allows fields sorting (tested in Stringer)
-		"sortVars": func(vars Vars) error {
-			sort.Sort(vars)
-			return nil
-		}, // allows vars sorting (tested in Stringer)
-		"sortMeths": func(methods Methods) error {
-			sort.Sort(methods)
-			return nil
-		}, // allows vars sorting (tested in Stringer)
+		"sortVars": func(vars Vars) Vars {
+			result := append(Vars(nil), vars...)
+			sort.Sort(result)
+			return result
+		}, // allows vars sorting
+		"sortMeths": func(methods Methods) Methods {
+			result := append(Methods(nil), methods...)
+			sort.Sort(result)
+			return result
+		}, // allows methods sorting
 		"dump": func(a interface{}) string {
 			return halp.SPrint(a)
 		},
-		"hasNotGenerated": func(pkg, kind string) (bool, error) {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.HasNotGenerated(pkg, kind)
-		},
-		"recurseGenerate": func(pkg, kind string) error {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.RecurseGenerate(pkg, kind)
-		},
-		"structByKey": func(key string) (*TypeInfo, error) {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.StructByKey(key)
-		},
-		"implements": func(fieldInfo TypeInfo) (bool, error) {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.Implements(fieldInfo)
-		},
-		"store": func(key string, value interface{}) error {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.Store(key, value)
-		},
-		"retrieve": func(key string) (interface{}, error) {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.Retrieve(key)
-		},
-		"hasInStore": func(key string) bool {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.HasInStore(key)
-		},
-		"addToImports": func(imp string) string {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.AddToImports(imp)
-		},
-		"declare": func(name string) error {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.Declare(name)
-		},
-		"listStored": func() []string {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.ListStored()
-		},
-		"types": func() TypesSlice {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.PackageInfo.Types
-		},
-		"typesInfo": func() *types.Info {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.PackageInfo.TypesInfo
-		},
-		"interfaces": func() TypesSlice {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.PackageInfo.Interfaces
-		},
-		"functions": func() Methods {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.PackageInfo.Functions
-		},
-		"vars": func() Vars {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.PackageInfo.Vars
-		},
-		"imports": func() []string {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.Imports
-		},
-		"name": func() string {
-			if Root == nil {
-				panic("Root is nil")
-			}
-			return Root.PackageInfo.Name
-		},
 	}
 	for k, v := range sprig.TxtFuncMap() {
 		if _, has := result[k]; !has {
@@ -649,6 +944,53 @@ func DefaultFuncMap() template.FuncMap {
 	return result
 }
 
+// the template functions bound to this code, so generations running at the same time don't share anything
+func (c *Code) FuncMap() template.FuncMap {
+	result := commonFuncMap()
+	for name, fn := range map[string]interface{}{
+		"hasNotGenerated": c.HasNotGenerated,
+		"recurseGenerate": c.RecurseGenerate,
+		"structByKey":     c.StructByKey,
+		"typeOf":          c.TypeOf,
+		"matchFields":     c.MatchFields,
+		"implements":      c.Implements,
+		"store":           c.Store,
+		"retrieve":        c.Retrieve,
+		"hasInStore":      c.HasInStore,
+		"addToImports":    c.AddToImports,
+		"declare":         c.Declare,
+		"regionBegin":     c.RegionBegin,
+		"regionEnd":       c.RegionEnd,
+		"listStored":      c.ListStored,
+		"types":           func() TypesSlice { return c.PackageInfo.Types },
+		"typesInfo":       func() *types.Info { return c.PackageInfo.TypesInfo },
+		"interfaces":      func() TypesSlice { return c.PackageInfo.Interfaces },
+		"functions":       func() Methods { return c.PackageInfo.Functions },
+		"vars":            func() Vars { return c.PackageInfo.Vars },
+		"imports":         func() []string { return c.Imports },
+		"name":            func() string { return c.PackageInfo.Name },
+	} {
+		result[name] = fn
+	}
+	return result
+}
+
+// the functions used for parsing templates : the ones needing the code fail until `New` binds
+// the template to a code (see `FuncMap`)
+func DefaultFuncMap() template.FuncMap {
+	result := commonFuncMap()
+	for name := range (&Code{}).FuncMap() {
+		if _, has := result[name]; has {
+			continue
+		}
+		name := name
+		result[name] = func(...interface{}) (interface{}, error) {
+			return nil, fmt.Errorf("%q : template is not bound to a code (see `New`)", name)
+		}
+	}
+	return result
+}
+
 // below is copy paste (with some modifications) from golang.org/x/tools/go/analysis/internal/checker,
 // because we cannot use that internal package
 type Action struct {
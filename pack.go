@@ -2,9 +2,16 @@ package stroo
 
 import (
 	"errors"
+	"fmt"
 	"go/ast"
+	"go/constant"
+	"go/token"
 	"go/types"
+	"golang.org/x/tools/go/packages"
 	"log"
+	"sort"
+	"strings"
+	"sync"
 )
 
 type Imports struct {
@@ -14,6 +21,7 @@ type Imports struct {
 type PackageInfo struct {
 	Name       string
 	Path       string
+	Dir        string // directory of the package files
 	Types      TypesSlice
 	Interfaces TypesSlice
 	Functions  Methods
@@ -21,6 +29,11 @@ type PackageInfo struct {
 	TypesInfo  *types.Info
 	Imports    []*Imports
 	PrintDebug bool
+	typesPkg   *types.Package            // the type checked package (see LookupType)
+	fset       *token.FileSet            // positions of the package files (and of the packages loaded by LookupType)
+	mu         sync.Mutex                // guards deps and described
+	deps       map[string]*types.Package // packages loaded by LookupType, because they are not imported
+	described  map[string]*TypeInfo      // types of other packages, described by TypeOf
 }
 
 func (pkg *PackageInfo) LoadImports(fromImports []*types.Package) {
@@ -32,455 +45,662 @@ func (pkg *PackageInfo) LoadImports(fromImports []*types.Package) {
 	}
 }
 
-func fixFieldsInfo(defs *types.Info, forType TypeInfo) error {
-	for idx := range forType.Fields {
-		for key, value := range defs.Defs {
-			if key.Name == forType.Fields[idx].Kind {
-				if forType.Fields[idx].Package == "" {
-					log.Printf("%q DOESN'T have a package", forType.Fields[idx].Kind)
-				}
-				underlyingValue := value.Type().Underlying()
-				switch underType := underlyingValue.(type) {
-				case *types.Pointer:
-					underlyingPointer := underType.Elem().Underlying()
-					if !forType.Fields[idx].IsPointer {
-						forType.Fields[idx].IsPointer = true
-					}
-					switch underPtr := underlyingPointer.(type) {
-					case *types.Struct:
-						forType.Fields[idx].IsStruct = true // this is mandatory
-					case *types.Slice:
-						if !forType.Fields[idx].IsArray {
-							forType.Fields[idx].IsArray = true
-						}
-					case *types.Interface:
-						if !forType.Fields[idx].IsInterface {
-							forType.Fields[idx].IsInterface = true
-						}
-					default:
-						log.Printf("Fixer [pointer]: %#v", underPtr)
-					}
-				case *types.Struct:
-					forType.Fields[idx].IsStruct = true // this is mandatory
-				case *types.Slice:
-					if !forType.Fields[idx].IsArray {
-						forType.Fields[idx].IsArray = true
-					}
-				case *types.Interface:
-					if !forType.Fields[idx].IsInterface {
-						forType.Fields[idx].IsInterface = true
-					}
-				case *types.Basic:
-					log.Printf("Fixer [basic]: %#v", underType) // this is never? the case ?
-				case *types.Signature:
-					// ignore signatures
-					//log.Printf("Fixer [signature]: %#v", underType)
-				default:
-					log.Printf("Fixer [?]: %#v", underType)
-				}
-				break // found it, bail out
-			}
+// finds a type by it's qualified name, e.g. `Local`, `fmt.Stringer` or `encoding/json.Marshaler`.
+// The packages imported (directly or not) by the current one are searched first, the others are loaded
+func (pkg *PackageInfo) LookupType(qualified string) (*types.TypeName, error) {
+	if pkg.typesPkg == nil {
+		return nil, errors.New("package was not type checked")
+	}
+	pkgPath, name := "", qualified
+	if idx := strings.LastIndex(qualified, "."); idx >= 0 {
+		pkgPath, name = qualified[:idx], qualified[idx+1:]
+	}
+	found := pkg.findPackage(pkgPath)
+	if found == nil {
+		var err error
+		found, err = pkg.loadDependency(pkgPath)
+		if err != nil {
+			return nil, err
 		}
 	}
-	return nil
+	obj := found.Scope().Lookup(name)
+	if obj == nil && pkgPath == "" {
+		obj = types.Universe.Lookup(name) // e.g. `error`
+	}
+	typeName, ok := obj.(*types.TypeName)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a type of package %q", name, found.Path())
+	}
+	return typeName, nil
 }
 
-func readIdent(ident *ast.Ident, comment *ast.CommentGroup) (*TypeInfo, error) {
-	var (
-		result TypeInfo
-		err    error
-	)
-	if comment != nil {
-		// direct call from Preorder
-		result.Comment = comment
+// TypeOf describes a type of any package, e.g. `github.com/x/model.User` or `model.User` (see LookupType).
+// Kinds are qualified relative to the current package, e.g. `model.Address` for a field of `model.User`.
+// The types of the current package are the ones already read, the others are described once
+func (pkg *PackageInfo) TypeOf(qualified string) (*TypeInfo, error) {
+	typeName, err := pkg.LookupType(qualified)
+	if err != nil {
+		return nil, err
 	}
-	result.Kind = ident.Name
-	return &result, err
+	if typeName.Pkg() == nil {
+		return nil, fmt.Errorf("%q is a predeclared type", qualified)
+	}
+	if typeName.Pkg() == pkg.typesPkg {
+		if result := pkg.Types.Extract(typeName.Name()); result != nil {
+			return result, nil
+		}
+		return nil, fmt.Errorf("%q was not read", qualified)
+	}
+	key := typeName.Pkg().Path() + "." + typeName.Name()
+	pkg.mu.Lock()
+	defer pkg.mu.Unlock()
+	if result, has := pkg.described[key]; has {
+		return result, nil
+	}
+	// without ast, the right hand side of the declaration is the underlying type (or the aliased one)
+	declared := typeName.Type().Underlying()
+	if alias, ok := typeName.Type().(*types.Alias); ok {
+		declared = alias.Rhs()
+	}
+	result, err := readTypeName(pkg.typesPkg, pkg.fset, typeName, declared, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if pkg.described == nil {
+		pkg.described = make(map[string]*TypeInfo)
+	}
+	pkg.described[key] = &result
+	return &result, nil
 }
 
-func readPointer(ptr *ast.StarExpr, comment *ast.CommentGroup) (*TypeInfo, error) {
-	var (
-		result TypeInfo
-		err    error
-	)
-	if comment != nil {
-		// direct call from Preorder
-		result.Comment = comment
-	}
-	result.IsPointer = true
-	switch typedSpec := ptr.X.(type) {
-	case *ast.Ident:
-		fieldInfo, err := readIdent(typedSpec, nil)
-		if err == nil {
-			result.Kind = fieldInfo.Kind
-		}
-	case *ast.SelectorExpr:
-		fieldInfo, err := readSelector(typedSpec, nil)
-		if err == nil {
-			result.Kind = fieldInfo.Kind
-			result.IsImported = fieldInfo.IsImported
-			if fieldInfo.Package != "" {
-				result.Package = fieldInfo.Package
-			}
-			result.IsImported = fieldInfo.IsImported
+// walks the imports graph looking for the package by path (or by name, if there is no path match)
+func (pkg *PackageInfo) findPackage(pathOrName string) *types.Package {
+	if pathOrName == "" || pathOrName == pkg.typesPkg.Path() {
+		return pkg.typesPkg
+	}
+	var byName *types.Package
+	visited := map[*types.Package]struct{}{pkg.typesPkg: {}}
+	queue := []*types.Package{pkg.typesPkg}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current.Path() == pathOrName {
+			return current
 		}
-	case *ast.ArrayType:
-		elInfo, err := readElemType(typedSpec)
-		if err == nil {
-			result.Kind = elInfo.Kind
-			result.IsPointer = elInfo.IsPointer
+		if byName == nil && current.Name() == pathOrName {
+			byName = current
+		}
+		for _, imprt := range current.Imports() {
+			if _, has := visited[imprt]; !has {
+				visited[imprt] = struct{}{}
+				queue = append(queue, imprt)
+			}
 		}
-	case *ast.MapType:
-		result.IsMap = true
-		result.Kind = "map (temporary)"
-	case *ast.ChanType:
-		result.IsChan = true
-		result.Kind = "chan (temporary)"
-	case *ast.StructType:
-		result.Kind = "struct (temporary)"
-	default:
-		//log.Printf("UNHANDLED PTR CASE : %T", typedSpec)
 	}
-	return &result, err
+	return byName
 }
 
-func readSelector(sel *ast.SelectorExpr, comment *ast.CommentGroup) (*TypeInfo, error) {
-	var (
-		result TypeInfo
-		err    error
-	)
-	if comment != nil {
-		// direct call from Preorder
-		result.Comment = comment
-	}
-	result.IsImported = true
-	result.Kind = sel.Sel.Name
-	if sel.Sel != nil {
-		idt, ok := sel.X.(*ast.Ident)
-		if ok {
-			fieldInfo, err := readIdent(idt, nil)
-			if err == nil {
-				result.Kind = fieldInfo.Kind + "." + result.Kind
-			}
-		} else {
-			log.Printf("BAD SELECTOR [NOT IDENT] : %#v", sel)
-		}
-	} else {
-		log.Printf("BAD SELECTOR [NIL SEL]: %#v", sel)
+// loads (once) a package which is not imported by the current one
+func (pkg *PackageInfo) loadDependency(path string) (*types.Package, error) {
+	pkg.mu.Lock()
+	defer pkg.mu.Unlock()
+	if loaded, has := pkg.deps[path]; has {
+		return loaded, nil
+	}
+	loadedPackages, err := packages.Load(&packages.Config{Mode: packages.NeedName | packages.NeedTypes, Dir: pkg.Dir, Fset: pkg.fset}, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(loadedPackages) != 1 || len(loadedPackages[0].Errors) > 0 || loadedPackages[0].Types == nil {
+		return nil, fmt.Errorf("package %q could not be loaded", path)
 	}
-	return &result, err
+	if pkg.deps == nil {
+		pkg.deps = make(map[string]*types.Package)
+	}
+	pkg.deps[path] = loadedPackages[0].Types
+	return loadedPackages[0].Types, nil
 }
 
-func readField(pkg *types.Package, field *ast.Field, comment *ast.CommentGroup) (TypesSlice, error) {
-	var (
-		oneResult  TypeInfo
-		err        error
-		fieldNames []string
-	)
+// reads a type declaration : the type checker provides the type, the ast provides comments (and order of fields).
+// The comment is the one of the `type` declaration, used when the spec has no comment of it's own
+func readType(pkg *types.Package, fset *token.FileSet, info *types.Info, astSpec *ast.TypeSpec, comment *ast.CommentGroup) (TypeInfo, error) {
+	if astSpec.Name == nil {
+		log.Printf("possible error : astSpec.Name is nil on %#v", astSpec)
+		return TypeInfo{}, errors.New("type name is nil")
+	}
+	typeName, ok := info.Defs[astSpec.Name].(*types.TypeName)
+	if !ok {
+		return TypeInfo{}, fmt.Errorf("%q is not a type name", astSpec.Name.Name)
+	}
+	// the right hand side of the declaration, e.g. `time.Ticker` for `type Timer time.Ticker`
+	declared := info.TypeOf(astSpec.Type)
+	if declared == nil {
+		return TypeInfo{}, fmt.Errorf("type checker has no type for %q", astSpec.Name.Name)
+	}
+	if astSpec.Doc != nil {
+		comment = astSpec.Doc // e.g. a type inside a `type ( ... )` block
+	}
+	result, err := readTypeName(pkg, fset, typeName, declared, info, astSpec.Type, comment)
+	result.LineComment = astSpec.Comment.Text()
+	return result, err
+}
 
-	oneResult.Comment = comment
-
-	oneResult.Package = pkg.Name()
-	oneResult.PackagePath = pkg.Path()
-	switch len(field.Names) {
-	case 0:
-		// embedded field
-		oneResult.IsEmbedded = true
-	case 1:
-		oneResult.IsExported = field.Names[0].IsExported()
-		oneResult.Name = field.Names[0].Name
+// describes a declared type, relative to the current package (pkg). Declared is the right hand side of the declaration.
+// The ast provides comments and the order of fields : astType and info are nil for the types of other packages
+func readTypeName(pkg *types.Package, fset *token.FileSet, typeName *types.TypeName, declared types.Type, info *types.Info, astType ast.Expr, comment *ast.CommentGroup) (TypeInfo, error) {
+	var result TypeInfo
+	result.Package = typeName.Pkg().Name()
+	result.PackagePath = typeName.Pkg().Path()
+	result.IsImported = typeName.Pkg() != pkg
+	result.Kind = typeName.Name()
+	if named, ok := typeName.Type().(*types.Named); ok {
+		result.TypeParams = readTypeParams(pkg, named.TypeParams())
+	}
+	switch typedSpec := types.Unalias(declared).(type) {
+	case *types.Struct:
+		result.Name = result.Kind
+		var astFields []*ast.Field
+		if structType, ok := astType.(*ast.StructType); ok {
+			astFields = structType.Fields.List
+		}
+		fields, err := readFields(pkg, fset, typedSpec, astFields)
+		if err != nil {
+			return result, fmt.Errorf("error reading fields of %q : %w", result.Kind, err)
+		}
+		result.Fields = fields
+	case *types.Slice, *types.Array:
+		// the type is described by it's element, e.g. `type Items []*Item` has kind `Item`
+		result.Name = result.Kind
+		elInfo := resolveType(pkg, typedSpec)
+		result.IsArray = true
+		result.IsSlice = elInfo.IsSlice
+		result.Len = elInfo.Len
+		result.Item = elInfo.Item
+		result.Fields = elInfo.Fields // e.g. `type Rows []struct{ Name string }`
+		if inline, astStruct := inlineStruct(typedSpec, astType); inline != nil && astStruct != nil {
+			fields, err := readFields(pkg, fset, inline, astStruct.Fields.List)
+			if err != nil {
+				return result, fmt.Errorf("error reading fields of %q : %w", result.Name, err)
+			}
+			result.Fields = fields
+		}
+		result.Kind = elInfo.Kind
+		result.IsPointer = elInfo.IsPointer
+		result.IsImported = elInfo.IsImported
+		result.IsTypeParam = elInfo.IsTypeParam
+		result.TypeArgs = elInfo.TypeArgs
+		result.IsMap = elInfo.IsMap
+		result.IsChan = elInfo.IsChan
+		result.ChanDir = elInfo.ChanDir
+		result.Key = elInfo.Key
+		result.Elem = elInfo.Elem
+	case *types.Map, *types.Chan:
+		// e.g. `type Set map[string]struct{}` or `type Events chan<- Event`
+		result.Name = result.Kind
+		elInfo := resolveType(pkg, typedSpec)
+		result.Kind = elInfo.Kind
+		result.IsMap = elInfo.IsMap
+		result.IsChan = elInfo.IsChan
+		result.ChanDir = elInfo.ChanDir
+		result.Key = elInfo.Key
+		result.Elem = elInfo.Elem
+	case *types.Interface:
+		result.Name = result.Kind
+		result.IsInterface = true
+		if interfaceType, ok := astType.(*ast.InterfaceType); ok {
+			result.Fields = readInterfaceMethods(pkg, fset, info, interfaceType)
+		} else {
+			result.Fields = readInterface(pkg, fset, typedSpec)
+		}
+		result.InterfaceMethods = readInterfaceMethodList(pkg, fset, typedSpec, result.Fields)
+		if !typedSpec.IsMethodSet() {
+			result.TypeSet = readTypeSet(pkg, typedSpec)
+			result.IsComparable = typedSpec.IsComparable()
+		}
+	case *types.Signature:
+		// convention, the type will have the first method describing the params and returns
+		result.Name = result.Kind
+		result.IsFunc = true
+		params, returns := readSignature(pkg, typedSpec)
+		result.MethodList = append(result.MethodList, FunctionInfo{
+			Package:     typeName.Pkg().Name(),
+			PackagePath: typeName.Pkg().Path(),
+			Name:        "func",
+			Params:      params,
+			Returns:     returns,
+			TypeParams:  result.TypeParams,
+			Doc:         comment.Text(),
+			comment:     comment,
+		})
 	default:
-		// processedField declaration is like `Name, Phone string`
-		oneResult.IsExported = field.Names[0].IsExported()
-		oneResult.Name = field.Names[0].Name
-		for idx, fieldName := range field.Names {
-			if idx > 0 {
-				fieldNames = append(fieldNames, fieldName.Name)
+		// e.g. : `type String string`, `type Timer time.Ticker`, `type Timer *time.Ticker`
+		fieldInfo := resolveType(pkg, declared)
+		result = NewAliasFromField(typeName.Pkg(), fieldInfo, typeName.Name())
+		// e.g. `type Timer time.Ticker` or `type Entry = S3` : the fields are the ones of the named struct
+		if underlying, ok := declared.Underlying().(*types.Struct); ok {
+			fields, err := readFields(pkg, fset, underlying, nil)
+			if err != nil {
+				return result, fmt.Errorf("error reading fields of %q : %w", result.Name, err)
 			}
+			result.IsStruct = true
+			result.Fields = fields
 		}
 	}
+	result.IsAlias = typeName.IsAlias()
+	// defined types need conversions from and to their underlying type (e.g. `string(name)`), aliases don't
+	switch underlying := typeName.Type().Underlying().(type) {
+	case *types.Struct, *types.Interface:
+	default:
+		result.Underlying = resolveType(pkg, underlying)
+	}
+	result.Comment = comment
+	result.Doc = comment.Text()
+	result.File, result.Line, result.Column = position(fset, typeName.Pos())
+	// how the type is used in code, e.g. `Page[T]` inside the methods of `type Page[T any] struct{}`
+	var typeParams TypeParams
+	if named, ok := typeName.Type().(*types.Named); ok {
+		typeParams = readTypeParams(pkg, named.TypeParams())
+	}
+	result.typeString = qualifiedName(pkg, typeName) + typeParams.Names()
+	result.typ = typeName.Type()
+	result.ValueMethods = readMethodSet(pkg, fset, types.Unalias(result.typ))
+	if !types.IsInterface(result.typ) {
+		result.PointerMethods = readMethodSet(pkg, fset, types.NewPointer(types.Unalias(result.typ)))
+	}
+	return result, nil
+}
 
-	switch typedSpec := field.Type.(type) {
-	case *ast.Ident:
-		fieldInfo, err := readIdent(typedSpec, nil)
-		if err == nil {
-			oneResult.Kind = fieldInfo.Kind
+// reads the fields of a struct. ast fields (if any) are used only to collect comments
+func readFields(pkg *types.Package, fset *token.FileSet, structType *types.Struct, astFields []*ast.Field) (TypesSlice, error) {
+	var result TypesSlice
+	for i := 0; i < structType.NumFields(); i++ {
+		field := structType.Field(i)
+		fieldInfo := resolveType(pkg, field.Type())
+		// fields are always reported in the package that declares the struct, unless they are imported kinds
+		if !fieldInfo.IsImported {
+			fieldInfo.Package = field.Pkg().Name()
+			fieldInfo.PackagePath = field.Pkg().Path()
+		}
+		if field.Embedded() {
+			fieldInfo.IsEmbedded = true
+		} else {
+			fieldInfo.Name = field.Name()
+			fieldInfo.IsExported = field.Exported()
 		}
-	case *ast.StarExpr:
-		fieldInfo, err := readPointer(typedSpec, nil)
-		if err == nil {
-			oneResult.IsPointer = fieldInfo.IsPointer
-			oneResult.Kind = fieldInfo.Kind
-			oneResult.IsImported = fieldInfo.IsImported
+		if astField := fieldAt(astFields, field.Pos()); astField != nil {
+			fieldInfo.Comment = astField.Comment
+			fieldInfo.Doc = astField.Doc.Text()
+			fieldInfo.LineComment = astField.Comment.Text()
 		}
-	case *ast.SelectorExpr:
-		fieldInfo, err := readSelector(typedSpec, nil)
-		if err == nil {
-			oneResult.IsImported = fieldInfo.IsImported
-			oneResult.Kind = fieldInfo.Kind
-			if fieldInfo.Package != "" {
-				oneResult.Package = fieldInfo.Package
+		fieldInfo.File, fieldInfo.Line, fieldInfo.Column = position(fset, field.Pos())
+		if astField := fieldAt(astFields, field.Pos()); astField != nil {
+			// read again with the ast, for the comments of the fields of inline structs
+			if inline, astStruct := inlineStruct(field.Type(), astField.Type); inline != nil && astStruct != nil {
+				fields, err := readFields(pkg, fset, inline, astStruct.Fields.List)
+				if err != nil {
+					return nil, fmt.Errorf("field %q : %w", field.Name(), err)
+				}
+				fieldInfo.Fields = fields
 			}
-			oneResult.IsImported = fieldInfo.IsImported
-		}
-	case *ast.MapType:
-		oneResult.IsMap = true
-		oneResult.Kind = "map (temporary)"
-		//log.Printf("%q is map", oneResult.Name)
-	case *ast.ChanType:
-		oneResult.IsChan = true
-		oneResult.Kind = "chan (temporary)"
-		// TODO : read chan kind
-		//log.Printf("%q is chan", oneResult.Name)
-	case *ast.ArrayType:
-		oneResult.IsArray = true
-		elemTypeInfo, err := readElemType(typedSpec)
-		if err == nil {
-			oneResult.IsPointer = elemTypeInfo.IsPointer
-			oneResult.Kind = elemTypeInfo.Kind
-		}
-		//log.Printf("%q is array : %#v", oneResult.Name, typedSpec)
-	case *ast.FuncType:
-		oneResult.IsFunc = true
-		//log.Printf("%q %s is func", oneResult.Name, oneResult.Kind)
-		params, returns, err := readFunc(typedSpec)
-		if err == nil {
-			oneResult.MethodList = append(oneResult.MethodList, FunctionInfo{Params: params, Returns: returns})
-		}
-	case *ast.InterfaceType:
-		oneResult.IsInterface = true
-		oneResult.Kind = "interface"
-	default:
-		//log.Printf("UNHANDLED FIELD CASE : %T", typedSpec)
+		}
+		if tag := structType.Tag(i); tag != "" {
+			var err error
+			fieldInfo.RawTag = tag
+			fieldInfo.Tags, err = ParseTags(tag)
+			if err != nil {
+				// the compiler accepts any tag : the field keeps it's RawTag and the analysis goes on
+				log.Printf("%s:%d:%d : field %q : %v", fieldInfo.File, fieldInfo.Line, fieldInfo.Column, field.Name(), err)
+			}
+		}
+		result = append(result, *fieldInfo)
 	}
+	return result, nil
+}
 
-	if field.Tag != nil {
-		oneResult.Tags, err = ParseTags(field.Tag.Value)
+// reads the methods (and embedded interfaces) of an interface as fields
+func readInterfaceMethods(pkg *types.Package, fset *token.FileSet, info *types.Info, interfaceType *ast.InterfaceType) TypesSlice {
+	var result TypesSlice
+	for _, method := range interfaceType.Methods.List {
+		if len(method.Names) == 0 {
+			// embedded interface or type set element
+			typ := info.TypeOf(method.Type)
+			if typ == nil {
+				log.Printf("type checker has no type for %s", types.ExprString(method.Type))
+				continue
+			}
+			fieldInfo := resolveType(pkg, typ)
+			fieldInfo.IsEmbedded = true
+			fieldInfo.Comment = method.Comment
+			fieldInfo.Doc = method.Doc.Text()
+			fieldInfo.LineComment = method.Comment.Text()
+			fieldInfo.File, fieldInfo.Line, fieldInfo.Column = position(fset, method.Type.Pos())
+			result = append(result, *fieldInfo)
+			continue
+		}
+		for _, name := range method.Names {
+			fn, ok := info.Defs[name].(*types.Func)
+			if !ok {
+				log.Printf("%q is not a method", name.Name)
+				continue
+			}
+			fieldInfo := resolveType(pkg, fn.Type())
+			fieldInfo.Package = pkg.Name()
+			fieldInfo.PackagePath = pkg.Path()
+			fieldInfo.Name = fn.Name()
+			fieldInfo.IsExported = fn.Exported()
+			fieldInfo.Comment = method.Comment
+			fieldInfo.Doc = method.Doc.Text()
+			fieldInfo.LineComment = method.Comment.Text()
+			fieldInfo.File, fieldInfo.Line, fieldInfo.Column = position(fset, fn.Pos())
+			result = append(result, *fieldInfo)
+		}
 	}
+	return result
+}
 
-	result := make(TypesSlice, 0)
-	result = append(result, oneResult)
-	if len(fieldNames) > 0 {
-		for _, name := range fieldNames {
-			result = append(result, oneResult.Clone(name))
+// reads the methods (and embedded interfaces) of an interface without ast, e.g. one declared in another package
+func readInterface(pkg *types.Package, fset *token.FileSet, iface *types.Interface) TypesSlice {
+	var result TypesSlice
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		fieldInfo := resolveType(pkg, iface.EmbeddedType(i))
+		fieldInfo.IsEmbedded = true
+		result = append(result, *fieldInfo)
+	}
+	for i := 0; i < iface.NumExplicitMethods(); i++ {
+		fn := iface.ExplicitMethod(i)
+		fieldInfo := resolveType(pkg, fn.Type())
+		if fn.Pkg() != nil {
+			fieldInfo.Package = fn.Pkg().Name()
+			fieldInfo.PackagePath = fn.Pkg().Path()
 		}
+		fieldInfo.Name = fn.Name()
+		fieldInfo.IsExported = fn.Exported()
+		fieldInfo.File, fieldInfo.Line, fieldInfo.Column = position(fset, fn.Pos())
+		result = append(result, *fieldInfo)
 	}
-
-	return result, err
+	return result
 }
 
-func readType(pkg *types.Package, astSpec *ast.TypeSpec, comment *ast.CommentGroup) (TypeInfo, error) {
-	var (
-		result TypeInfo
-		err    error
-	)
-	result.Comment = comment
-	if astSpec.Name == nil {
-		log.Printf("possible error : astSpec.Name is nil on %#v", astSpec)
-		return TypeInfo{}, errors.New("type name is nil")
-	}
-	result.Package = pkg.Name()
-	result.PackagePath = pkg.Path()
-	result.Kind = astSpec.Name.Name
-	switch typedSpec := astSpec.Type.(type) {
-	case *ast.StructType:
-		result.Name = result.Kind
-		//log.Printf("Traversing struct kind : %q", result.Kind)
-		for _, field := range typedSpec.Fields.List {
-			fieldsInfo, err := readField(pkg, field, field.Comment)
-			if err == nil {
-				result.Fields = append(result.Fields, fieldsInfo...)
-			}
+// reads all the methods of an interface, each once : the declared ones in order of declaration, followed by the ones of
+// the embedded interfaces (marked as promoted), in order of embedding. The docs of the declared methods are taken from
+// the fields (see readInterfaceMethods). Methods coming from an embedded interface have it as receiver type
+func readInterfaceMethodList(pkg *types.Package, fset *token.FileSet, iface *types.Interface, fields TypesSlice) Methods {
+	var result Methods
+	seen := make(map[string]struct{})
+	var walk func(iface *types.Interface, promoted bool)
+	walk = func(iface *types.Interface, promoted bool) {
+		explicit := make([]*types.Func, 0, iface.NumExplicitMethods())
+		for i := 0; i < iface.NumExplicitMethods(); i++ {
+			explicit = append(explicit, iface.ExplicitMethod(i))
 		}
-	case *ast.ArrayType:
-		//log.Printf("Traversing array : %q", result.Kind)
-		result.Name = astSpec.Name.Name
-		result.IsArray = true
-		elInfo, err := readElemType(typedSpec)
-		if err == nil {
-			result.Kind = elInfo.Kind
-			result.IsPointer = elInfo.IsPointer
-			result.IsImported = elInfo.IsImported
-		}
-	case *ast.InterfaceType:
-		for _, method := range typedSpec.Methods.List {
-			fieldInfo, err := readField(pkg, method, nil)
-			if err == nil {
-				result.Fields = append(result.Fields, fieldInfo...)
+		// the type checker sorts the methods by name, their positions give back the order of declaration
+		sort.SliceStable(explicit, func(i, j int) bool { return explicit[i].Pos() < explicit[j].Pos() })
+		for _, fn := range explicit {
+			if _, has := seen[fn.Id()]; has {
+				continue
+			}
+			seen[fn.Id()] = struct{}{}
+			method := readFunc(pkg, fset, fn)
+			method.IsPromoted = promoted
+			if !promoted {
+				for _, field := range fields {
+					if field.Name == fn.Name() {
+						method.Doc = field.Doc
+						break
+					}
+				}
 			}
+			result = append(result, method)
 		}
-	case *ast.FuncType:
-		result.Name = result.Kind
-		paramsInfo, resultsInfo, err := readFunc(typedSpec)
-		if err == nil {
-			result.MethodList = append(result.MethodList, FunctionInfo{
-				Package:     pkg.Name(),
-				PackagePath: pkg.Path(),
-				Name:        "func",
-				Params:      paramsInfo,
-				Returns:     resultsInfo,
-				comment:     comment,
-				//IsExported:  ???,
-			})
+		for i := 0; i < iface.NumEmbeddeds(); i++ {
+			// type set elements (e.g. `~int | ~string`) have no methods
+			if embedded, ok := iface.EmbeddedType(i).Underlying().(*types.Interface); ok {
+				walk(embedded, true)
+			}
 		}
-	default:
-		//log.Printf("UNHANDLED TYPE CASE : %T", typedSpec)
 	}
-	return result, err
+	walk(iface, false)
+	return result
 }
 
-func readElemType(arr *ast.ArrayType) (*TypeInfo, error) {
+// reads the types allowed by a constraint interface, e.g. `~int | ~string`. Embedded constraints are expanded and
+// the terms of many elements are intersected (only the types allowed by all of them are kept)
+func readTypeSet(pkg *types.Package, iface *types.Interface) TypeTerms {
 	var (
-		result TypeInfo
-		err    error
+		result     TypeTerms
+		restricted bool
 	)
-	switch elType := arr.Elt.(type) {
-	case *ast.Ident:
-		fieldInfo, err := readIdent(elType, nil)
-		if err == nil {
-			result.Kind = fieldInfo.Kind
-		}
-	case *ast.StarExpr:
-		fieldInfo, err := readPointer(elType, nil)
-		if err == nil {
-			result.Kind = fieldInfo.Kind
-			result.IsPointer = fieldInfo.IsPointer
-			result.IsImported = fieldInfo.IsImported
-		}
-	case *ast.SelectorExpr:
-		fieldInfo, err := readSelector(elType, nil)
-		if err == nil {
-			result.Kind = fieldInfo.Kind
-			result.IsPointer = fieldInfo.IsPointer   // TODO : check
-			result.IsImported = fieldInfo.IsImported // TODO : check
-			if fieldInfo.Package != "" {
-				result.Package = fieldInfo.Package // TODO : check
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		var terms TypeTerms
+		switch embedded := iface.EmbeddedType(i).(type) {
+		case *types.Union:
+			for j := 0; j < embedded.Len(); j++ {
+				terms = append(terms, TypeTerm{Tilde: embedded.Term(j).Tilde(), Type: resolveType(pkg, embedded.Term(j).Type())})
+			}
+		default:
+			inner, ok := embedded.Underlying().(*types.Interface)
+			if !ok {
+				// e.g. `interface{ int }`
+				terms = TypeTerms{{Type: resolveType(pkg, embedded)}}
+				break
 			}
-			if result.PackagePath != "" {
-				result.PackagePath = fieldInfo.PackagePath // TODO : check
+			if inner.IsMethodSet() {
+				continue // any type, e.g. `fmt.Stringer`
+			}
+			if terms = readTypeSet(pkg, inner); terms == nil {
+				continue // e.g. `comparable`
 			}
 		}
-	case *ast.ArrayType:
-		elInfo, err := readElemType(elType)
-		if err == nil {
-			result.Kind = elInfo.Kind
-			result.IsPointer = elInfo.IsPointer
-		}
-	case *ast.MapType:
-		result.Kind = "map (temporary)"
-	case *ast.StructType:
-		result.Kind = "struct (temporary)"
-	case *ast.ChanType:
-		result.Kind = "chan (temporary)"
-	default:
-		//log.Printf("UNHANDLED ELEM CASE : %T", elType)
+		if !restricted {
+			result, restricted = terms, true
+			continue
+		}
+		result = intersectTerms(result, terms)
 	}
-	return &result, err
+	return result
 }
 
-func readFunc(spec *ast.FuncType) ([]VarInfo, []VarInfo, error) {
-	var (
-		err error
-	)
-	var params []VarInfo
-	if spec.Params != nil {
-		for _, p := range spec.Params.List {
-			param := buildVarFromExpr(p)
-			if param.Kind == "" && param.Name == "" {
-				log.Printf("noname/notype found while inspecting params of %#v", spec.Params.List)
-				continue
+// the terms allowed by both sets, e.g. `~int | string` and `int | ~string` give `int | string`
+func intersectTerms(first, second TypeTerms) TypeTerms {
+	var result TypeTerms
+	for _, a := range first {
+		for _, b := range second {
+			switch {
+			case a.Tilde && b.Tilde, !a.Tilde && !b.Tilde:
+				if types.Identical(a.Type.typ, b.Type.typ) {
+					result = append(result, a)
+				}
+			case a.Tilde:
+				if types.Identical(a.Type.typ, b.Type.typ.Underlying()) {
+					result = append(result, b)
+				}
+			default:
+				if types.Identical(a.Type.typ.Underlying(), b.Type.typ) {
+					result = append(result, a)
+				}
 			}
-			params = append(params, param)
 		}
 	}
-	var returns []VarInfo
-	if spec.Results != nil {
-		for _, r := range spec.Results.List {
-			param := buildVarFromExpr(r)
-			if param.Kind == "" && param.Name == "" {
-				log.Printf("noname/notype found while inspecting returns of %#v", spec.Results.List)
-				continue
-			}
-			returns = append(returns, param)
+	return result
+}
+
+// finds the inline struct of a field through pointers, slices and arrays (e.g. `[]*struct{ Name string }`) and the
+// ast which declares it (nil if the field is not an inline struct)
+func inlineStruct(typ types.Type, expr ast.Expr) (*types.Struct, *ast.StructType) {
+	for {
+		switch realType := typ.(type) {
+		case *types.Pointer:
+			typ = realType.Elem()
+		case *types.Slice:
+			typ = realType.Elem()
+		case *types.Array:
+			typ = realType.Elem()
+		case *types.Struct:
+			astStruct, _ := expr.(*ast.StructType)
+			return realType, astStruct
+		default:
+			return nil, nil
 		}
+		switch astExpr := expr.(type) {
+		case *ast.StarExpr:
+			expr = astExpr.X
+		case *ast.ArrayType:
+			expr = astExpr.Elt
+		case *ast.ParenExpr:
+			expr = astExpr.X
+		default:
+			expr = nil
+		}
+	}
+}
+
+// finds the ast field which declares the object at the provided position
+func fieldAt(fields []*ast.Field, pos token.Pos) *ast.Field {
+	for _, field := range fields {
+		if field.Pos() <= pos && pos < field.End() {
+			return field
+		}
+	}
+	return nil
+}
+
+// where the object at the provided position is declared : file, line and column (empty without a position)
+func position(fset *token.FileSet, pos token.Pos) (string, int, int) {
+	if fset == nil || !pos.IsValid() {
+		return "", 0, 0
 	}
-	return params, returns, err
+	result := fset.Position(pos)
+	return result.Filename, result.Line, result.Column
 }
 
 // get function information from the function object
-func readFuncDecl(spec *ast.FuncDecl) (*FunctionInfo, error) {
+func readFuncDecl(pkg *types.Package, fset *token.FileSet, typesInfo *types.Info, spec *ast.FuncDecl) (*FunctionInfo, error) {
 	if spec.Name == nil {
 		return nil, errors.New("spec name is nil while reading function")
 	}
+	fn, ok := typesInfo.Defs[spec.Name].(*types.Func)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a function", spec.Name.Name)
+	}
+	info := readFunc(pkg, fset, fn)
+	info.comment = spec.Doc
+	info.Doc = spec.Doc.Text()
+	return &info, nil
+}
+
+// reads a function (or method) from the type checker's object
+func readFunc(pkg *types.Package, fset *token.FileSet, fn *types.Func) FunctionInfo {
+	signature := fn.Type().(*types.Signature)
 	info := FunctionInfo{
-		Name:       spec.Name.Name,
-		IsExported: spec.Name.IsExported(),
-		comment:    spec.Doc,
-	}
-	if spec.Recv != nil {
-		if len(spec.Recv.List) > 0 {
-			stList := spec.Recv.List[0]
-			if len(stList.Names) > 0 {
-				info.ReceiverName = stList.Names[0].Name
-			}
-			switch recType := stList.Type.(type) {
-			case *ast.Ident:
-				info.ReceiverType = recType.Name
-			case *ast.StarExpr:
-				info.IsMethodReceiver = true
-				info.ReceiverType = recType.X.(*ast.Ident).Name
-			default:
-				//log.Printf("don't know what to do with receiver : %T %#v", recType, recType)
-			}
+		Name:       fn.Name(),
+		IsExported: fn.Exported(),
+		TypeParams: readTypeParams(pkg, signature.TypeParams()),
+	}
+	info.File, info.Line, info.Column = position(fset, fn.Pos())
+	if fn.Pkg() != nil {
+		info.Package = fn.Pkg().Name()
+		info.PackagePath = fn.Pkg().Path()
+	}
+	if receiver := signature.Recv(); receiver != nil {
+		info.ReceiverName = receiver.Name()
+		receiverType := receiver.Type()
+		if ptr, ok := receiverType.(*types.Pointer); ok {
+			info.IsMethodReceiver = true
+			receiverType = ptr.Elem()
+		}
+		if named, ok := types.Unalias(receiverType).(*types.Named); ok {
+			info.ReceiverType = named.Obj().Name()
 		}
 	}
-	params, returns, err := readFunc(spec.Type)
-	if err == nil {
-		info.Params = params
-		info.Returns = returns
+	info.Params, info.Returns = readSignature(pkg, signature)
+	return info
+}
+
+// reads the method set of the type, including the methods promoted from embedded fields
+func readMethodSet(pkg *types.Package, fset *token.FileSet, typ types.Type) Methods {
+	methodSet := types.NewMethodSet(typ)
+	var result Methods
+	for i := 0; i < methodSet.Len(); i++ {
+		selection := methodSet.At(i)
+		fn, ok := selection.Obj().(*types.Func)
+		if !ok {
+			continue
+		}
+		method := readFunc(pkg, fset, fn)
+		method.IsPromoted = len(selection.Index()) > 1
+		result = append(result, method)
 	}
-	return &info, nil
+	return result
 }
 
-func buildVarFromExpr(field *ast.Field) VarInfo {
-	var param VarInfo
-	if len(field.Names) == 1 {
-		param.Name = field.Names[0].Name //  it has a name
-	}
-	switch paramType := field.Type.(type) {
-	case *ast.Ident:
-		fieldInfo, err := readIdent(paramType, nil)
-		if err == nil {
-			param.Kind = fieldInfo.Kind
-		}
-	case *ast.StarExpr:
-		fieldInfo, err := readPointer(paramType, nil)
-		if err == nil {
-			param.Kind = fieldInfo.Kind
-		}
-	case *ast.SelectorExpr:
-		fieldInfo, err := readSelector(paramType, nil)
-		if err == nil {
-			param.Kind = fieldInfo.Kind // TODO : check
-		}
-	case *ast.ArrayType:
-		typeInfo, err := readElemType(paramType)
-		if err == nil {
-			param.Kind = "[]" + typeInfo.Kind
-		}
-	case *ast.InterfaceType:
-		param.Kind = "interface"
-	case *ast.FuncType:
-		param.Kind = "function"
-	case *ast.MapType:
-		param.Kind = "map"
-	default:
-		log.Printf("UNHANDLED PARAM/RETURN CASE : %T", paramType)
+// reads params and returns of a function signature
+func readSignature(pkg *types.Package, signature *types.Signature) ([]VarInfo, []VarInfo) {
+	params := readTuple(pkg, signature.Params())
+	if signature.Variadic() && len(params) > 0 {
+		// the last param is a slice, declared as `...T`
+		last := &params[len(params)-1]
+		last.IsVariadic = true
+		if slice, ok := signature.Params().At(len(params) - 1).Type().(*types.Slice); ok {
+			last.TypeString = "..." + types.TypeString(slice.Elem(), relativeTo(pkg))
+		}
 	}
-	return param
+	return params, readTuple(pkg, signature.Results())
 }
 
-func readValue(defObj types.Object, valueSpec *ast.ValueSpec) ([]VarInfo, error) {
+// reads the params (or returns) of a signature, one for each name (`a, b int` are two params)
+func readTuple(pkg *types.Package, tuple *types.Tuple) []VarInfo {
+	var result []VarInfo
+	for i := 0; i < tuple.Len(); i++ {
+		variable := tuple.At(i)
+		info := resolveType(pkg, variable.Type())
+		result = append(result, VarInfo{
+			Name:       variable.Name(),
+			Kind:       info.Kind,
+			TypeString: info.TypeString(),
+			Info:       info,
+		})
+	}
+	return result
+}
+
+// points the params (or returns) to the declarations of their kinds, when the kinds are types of the current package
+func resolveVars(declared TypesSlice, vars []VarInfo) {
+	for idx := range vars {
+		info := vars[idx].Info
+		if info == nil || info.IsImported || info.IsTypeParam {
+			continue
+		}
+		for _, typeDef := range declared {
+			if typeDef.Name == info.Kind {
+				typeDef := typeDef
+				vars[idx].Type = &typeDef
+				break
+			}
+		}
+	}
+}
+
+// reads the type parameters list, e.g. `[K comparable, V any]`
+func readTypeParams(pkg *types.Package, list *types.TypeParamList) TypeParams {
+	if list == nil {
+		return nil
+	}
+	var result TypeParams
+	for i := 0; i < list.Len(); i++ {
+		param := list.At(i)
+		result = append(result, TypeParam{
+			Name:       param.Obj().Name(),
+			Constraint: types.TypeString(param.Constraint(), relativeTo(pkg)),
+		})
+	}
+	return result
+}
+
+// reads the names of a `var` or `const` spec. The doc is the one of the block, used when the spec has no doc
+func readValue(fset *token.FileSet, defObj types.Object, valueSpec *ast.ValueSpec, doc *ast.CommentGroup) ([]VarInfo, error) {
+	if valueSpec.Doc != nil {
+		doc = valueSpec.Doc
+	}
 	var result []VarInfo
 	for _, varName := range valueSpec.Names {
 		var name string
@@ -490,10 +710,217 @@ func readValue(defObj types.Object, valueSpec *ast.ValueSpec) ([]VarInfo, error)
 		case *types.Const:
 			name = defObj.(*types.Const).Type().String()
 		}
-		result = append(result, VarInfo{
-			Name: varName.Name,
-			Kind: name,
-		})
+		info := VarInfo{
+			Name:        varName.Name,
+			Kind:        name,
+			Doc:         doc.Text(),
+			LineComment: valueSpec.Comment.Text(),
+		}
+		info.File, info.Line, info.Column = position(fset, varName.Pos())
+		result = append(result, info)
 	}
 	return result, nil
 }
+
+// reads the constants of a spec which are typed with a type declared in the current package (enums), by type name.
+// iota is the index of the spec inside the `const` block, doc is the comment of the block (used for single spec blocks)
+func readConsts(pkg *types.Package, fset *token.FileSet, info *types.Info, valueSpec *ast.ValueSpec, iota int, doc *ast.CommentGroup) map[string]Consts {
+	result := make(map[string]Consts)
+	specDoc := valueSpec.Doc
+	if specDoc == nil {
+		specDoc = doc
+	}
+	comment := specDoc
+	if comment == nil {
+		comment = valueSpec.Comment
+	}
+	for _, name := range valueSpec.Names {
+		if name.Name == "_" {
+			continue
+		}
+		obj, ok := info.Defs[name].(*types.Const)
+		if !ok || obj.Parent() != pkg.Scope() {
+			continue // not a package level constant
+		}
+		named, ok := types.Unalias(obj.Type()).(*types.Named)
+		if !ok || named.Obj().Pkg() != pkg {
+			continue
+		}
+		value := obj.Val().ExactString()
+		if obj.Val().Kind() == constant.Float {
+			value = obj.Val().String() // exact floats are fractions
+		}
+		constInfo := ConstInfo{
+			Name:        name.Name,
+			Value:       value,
+			Iota:        iota,
+			IsExported:  name.IsExported(),
+			Comment:     comment,
+			Doc:         specDoc.Text(),
+			LineComment: valueSpec.Comment.Text(),
+		}
+		constInfo.File, constInfo.Line, constInfo.Column = position(fset, name.Pos())
+		result[named.Obj().Name()] = append(result[named.Obj().Name()], constInfo)
+	}
+	return result
+}
+
+// marks the constants having the value of a previous one
+func markDuplicates(consts Consts) Consts {
+	seen := make(map[string]struct{})
+	for idx := range consts {
+		if _, has := seen[consts[idx].Value]; has {
+			consts[idx].IsDuplicate = true
+			continue
+		}
+		seen[consts[idx].Value] = struct{}{}
+	}
+	return consts
+}
+
+// builds the type information from the type checker's type.
+// Conventions : pointers and slices are flags, while the kind is the pointed or element type
+// (e.g. `[]*Item` has kind `Item`, IsArray and IsPointer); maps and chans have the kind
+// as declared and describe their key and element
+func resolveType(pkg *types.Package, typ types.Type) *TypeInfo {
+	result := &TypeInfo{
+		Package:     pkg.Name(),
+		PackagePath: pkg.Path(),
+		Kind:        types.TypeString(typ, relativeTo(pkg)),
+	}
+	switch realType := typ.(type) {
+	case *types.Basic:
+		result.Kind = realType.Name()
+	case *types.Alias:
+		// e.g. `any` : flags are the ones of the aliased type, but we keep the name
+		result = resolveType(pkg, types.Unalias(realType))
+		result.Kind = qualifiedName(pkg, realType.Obj())
+	case *types.Named:
+		obj := realType.Obj()
+		result.Kind = qualifiedName(pkg, obj)
+		if obj.Pkg() != nil && obj.Pkg() != pkg {
+			result.Package = obj.Pkg().Name()
+			result.PackagePath = obj.Pkg().Path()
+			result.IsImported = true
+		}
+		for i := 0; i < realType.TypeArgs().Len(); i++ {
+			result.TypeArgs = append(result.TypeArgs, *resolveType(pkg, realType.TypeArgs().At(i)))
+		}
+		switch underType := realType.Underlying().(type) {
+		case *types.Struct:
+			result.IsStruct = true
+		case *types.Interface:
+			result.IsInterface = true
+		case *types.Slice:
+			result.IsArray = true
+			result.IsSlice = true
+		case *types.Array:
+			result.IsArray = true
+			result.Len = underType.Len()
+		case *types.Map:
+			result.IsMap = true
+		case *types.Chan:
+			result.IsChan = true
+		case *types.Signature:
+			result.IsFunc = true
+		case *types.Pointer:
+			// e.g. `type PtrToStruct *Struct`
+			result.IsPointer = true
+			switch types.Unalias(underType.Elem()).Underlying().(type) {
+			case *types.Struct:
+				result.IsStruct = true
+			case *types.Slice:
+				result.IsArray = true
+				result.IsSlice = true
+			case *types.Array:
+				result.IsArray = true
+			case *types.Interface:
+				result.IsInterface = true
+			}
+		}
+	case *types.TypeParam:
+		result.Kind = realType.Obj().Name()
+		result.IsTypeParam = true
+	case *types.Pointer:
+		// pointers to slices (e.g. `*[]int`) are pointers too, Item tells if the items are pointers (e.g. `[]*int`)
+		result = resolveType(pkg, realType.Elem())
+		result.IsPointer = true
+	case *types.Slice:
+		// IsSlice, Len and Item describe the outer slice (or array), the kind and the other flags are the ones of the items
+		result = resolveType(pkg, realType.Elem())
+		result.IsArray = true
+		result.IsSlice = true
+		result.Len = 0
+		result.Item = resolveItem(pkg, realType.Elem())
+	case *types.Array:
+		result = resolveType(pkg, realType.Elem())
+		result.IsArray = true
+		result.IsSlice = false
+		result.Len = realType.Len()
+		result.Item = resolveItem(pkg, realType.Elem())
+	case *types.Map:
+		result.IsMap = true
+		result.Key = resolveType(pkg, realType.Key())
+		result.Elem = resolveType(pkg, realType.Elem())
+	case *types.Chan:
+		result.IsChan = true
+		result.ChanDir = chanDir(realType.Dir())
+		result.Elem = resolveType(pkg, realType.Elem())
+	case *types.Struct:
+		// inline struct, e.g. `Meta struct{ A int }`
+		result.IsStruct = true
+		fields, err := readFields(pkg, nil, realType, nil)
+		if err != nil {
+			log.Printf("error reading fields of %s : %v", result.Kind, err)
+		}
+		result.Fields = fields
+	case *types.Interface:
+		result.IsInterface = true
+	case *types.Signature:
+		result.IsFunc = true
+		params, returns := readSignature(pkg, realType)
+		result.MethodList = append(result.MethodList, FunctionInfo{Params: params, Returns: returns})
+	}
+	result.typeString = types.TypeString(typ, relativeTo(pkg))
+	result.typ = typ
+	return result
+}
+
+// describes the items of a slice or array as they are, e.g. `*[]int` for `[]*[]int`. Unlike the flags of the slice
+// (which are the ones of the innermost items), IsPointer tells if the item itself is a pointer
+func resolveItem(pkg *types.Package, typ types.Type) *TypeInfo {
+	result := resolveType(pkg, typ)
+	if _, isNamed := types.Unalias(typ).(*types.Named); !isNamed {
+		_, result.IsPointer = types.Unalias(typ).(*types.Pointer)
+	}
+	return result
+}
+
+// returns the name of the object, prefixed with it's package name if it's not the current package
+func qualifiedName(pkg *types.Package, obj types.Object) string {
+	if obj.Pkg() != nil && obj.Pkg() != pkg {
+		return obj.Pkg().Name() + "." + obj.Name()
+	}
+	return obj.Name()
+}
+
+// qualifier which omits the current package name
+func relativeTo(pkg *types.Package) types.Qualifier {
+	return func(other *types.Package) string {
+		if pkg == other {
+			return ""
+		}
+		return other.Name()
+	}
+}
+
+func chanDir(dir types.ChanDir) string {
+	switch dir {
+	case types.SendOnly:
+		return "chan<-"
+	case types.RecvOnly:
+		return "<-chan"
+	default:
+		return "chan"
+	}
+}
@@ -1,17 +1,24 @@
 package stroo_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	. "github.com/badu/stroo"
 	"github.com/badu/stroo/halp"
-	"go/ast"
 	"go/types"
 	"golang.org/x/tools/go/packages"
 	"io/ioutil"
+	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"text/template"
+	"time"
 )
 
 type testCase struct {
@@ -29,73 +36,75 @@ var cases = []testCase{
 	{
 		name:       "slice of int",
 		outputName: "T0",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T0", Kind: "int", IsArray: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T0", Kind: "int", IsArray: true, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "int"}},
 	}, // 0
 	{
 		name:       "p1",
 		outputName: "T1",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T1", Kind: "int", IsPointer: true, IsArray: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T1", Kind: "int", IsPointer: true, IsArray: true, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "int", IsPointer: true}},
 	}, // 1
 	{
 		name:       "p2",
 		outputName: "T2",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T2", Kind: "int", IsArray: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T2", Kind: "int", IsArray: true, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "int", IsArray: true, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "int"}}},
 	}, // 2.
 	{
 		name:       "p2_1",
 		outputName: "T2_1",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T2_1", Kind: "int", IsArray: true}, //, IsPointer: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T2_1", Kind: "int", IsPointer: true, IsArray: true, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "int", IsPointer: true, IsArray: true, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "int"}}},
 	}, // 2.1.
 	{
 		name:       "p3",
 		outputName: "T3",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T3", Kind: "map (temporary)", IsArray: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T3", Kind: "map[string]string", IsArray: true, IsMap: true, Key: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"}, Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"}, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "map[string]string", IsMap: true, Key: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"}, Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"}}},
 	}, // 3. `
 	{
 		name:       "p4",
 		outputName: "T4",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T4", Kind: "map (temporary)", IsArray: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T4", Kind: "map[S]string", IsArray: true, IsMap: true, Key: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "S", IsStruct: true}, Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"}, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "map[S]string", IsMap: true, Key: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "S", IsStruct: true}, Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"}}},
 	}, // 4. `
 	{
 		name:       "p5",
 		outputName: "T5",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T5", Kind: "map (temporary)", IsArray: true, IsPointer: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T5", Kind: "map[S2]string", IsArray: true, IsPointer: true, IsMap: true, Key: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "S2", IsStruct: true}, Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"}, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "map[S2]string", IsPointer: true, IsMap: true, Key: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "S2", IsStruct: true}, Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"}}},
 	}, // 5. `
 	{
 		name:       "p6",
 		outputName: "T6",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T6", Kind: "struct (temporary)", IsArray: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T6", Kind: "struct{Name string}", IsArray: true, IsSlice: true, Fields: TypesSlice{{Package: testPackage, PackagePath: testPackagePath, Name: "Name", Kind: "string", IsExported: true}}, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "struct{Name string}", IsStruct: true, Fields: TypesSlice{{Package: testPackage, PackagePath: testPackagePath, Name: "Name", Kind: "string", IsExported: true}}}},
 	}, // 6. `
 	{
 		name:       "p7",
 		outputName: "T7",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T7", Kind: "chan (temporary)", IsArray: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T7", Kind: "chan string", IsArray: true, IsChan: true, ChanDir: "chan", Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"}, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "chan string", IsChan: true, ChanDir: "chan", Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"}}},
 	}, // 7. `
 	{
 		name:       "p8",
 		outputName: "T8",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T8", Kind: "chan (temporary)", IsArray: true, IsPointer: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T8", Kind: "chan string", IsArray: true, IsPointer: true, IsChan: true, ChanDir: "chan", Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"}, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "chan string", IsPointer: true, IsChan: true, ChanDir: "chan", Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"}}},
 	}, // 8. `
 	{
 		name:       "p9",
 		outputName: "T9",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T9", Kind: "chan (temporary)", IsArray: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T9", Kind: "chan struct{}", IsArray: true, IsChan: true, ChanDir: "chan", Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "struct{}", IsStruct: true}, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "chan struct{}", IsChan: true, ChanDir: "chan", Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "struct{}", IsStruct: true}}},
 	}, // 9. `
 	{
 		name:       "p10",
 		outputName: "T10",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T10", Kind: "chan (temporary)", IsArray: true, IsPointer: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T10", Kind: "chan *struct{}", IsArray: true, IsPointer: true, IsChan: true, ChanDir: "chan", Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "struct{}", IsPointer: true, IsStruct: true}, IsSlice: true, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "chan *struct{}", IsPointer: true, IsChan: true, ChanDir: "chan", Elem: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "struct{}", IsPointer: true, IsStruct: true}}},
 	}, // 10. `
 	{
 		name:       "p11",
 		outputName: "T11",
-		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T11", Kind: "struct (temporary)", IsArray: true, IsPointer: true},
+		output:     &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Name: "T11", Kind: "struct{Name string}", IsArray: true, IsPointer: true, IsSlice: true, Fields: TypesSlice{{Package: testPackage, PackagePath: testPackagePath, Name: "Name", Kind: "string", IsExported: true}}, Item: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "struct{Name string}", IsPointer: true, IsStruct: true, Fields: TypesSlice{{Package: testPackage, PackagePath: testPackagePath, Name: "Name", Kind: "string", IsExported: true}}}},
 	}, // 11. `
 	{
 		name:       "p12",
 		outputName: "T12",
 		output: &TypeInfo{
 			Name:        "T12",
+			IsSlice:     true,
+			Item:        &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "S3", IsStruct: true},
 			Kind:        "S3",
 			Package:     testPackage,
 			PackagePath: testPackagePath,
@@ -107,6 +116,8 @@ var cases = []testCase{
 		outputName: "T13",
 		output: &TypeInfo{
 			Name:        "T13",
+			IsSlice:     true,
+			Item:        &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "S13", IsStruct: true},
 			Kind:        "S13",
 			Package:     testPackage,
 			PackagePath: testPackagePath,
@@ -118,6 +129,8 @@ var cases = []testCase{
 		outputName: "T14",
 		output: &TypeInfo{
 			Name:        "T14",
+			IsSlice:     true,
+			Item:        &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "S4", IsPointer: true, IsStruct: true},
 			Kind:        "S4",
 			IsPointer:   true,
 			IsArray:     true,
@@ -134,6 +147,9 @@ var cases = []testCase{
 			PackagePath: testPackagePath,
 			Name:        "T15",
 			Kind:        "T15",
+			// promoted from the embedded error
+			ValueMethods:   Methods{{Name: "Error", ReceiverType: "error", IsExported: true, IsPromoted: true, Returns: returnsOf("string")}},
+			PointerMethods: Methods{{Name: "Error", ReceiverType: "error", IsExported: true, IsPromoted: true, Returns: returnsOf("string")}},
 			Fields: TypesSlice{
 				TypeInfo{
 					PackagePath: testPackagePath,
@@ -141,14 +157,7 @@ var cases = []testCase{
 					Kind:        "EmbeddedS",
 					IsEmbedded:  true,
 					IsStruct:    true,
-					Comment: &ast.CommentGroup{
-						List: []*ast.Comment{
-							{
-								Slash: 524931,
-								Text:  "// embedded",
-							},
-						},
-					},
+					LineComment: "embedded\n",
 				},
 				TypeInfo{
 					PackagePath: testPackagePath,
@@ -157,14 +166,7 @@ var cases = []testCase{
 					IsPointer:   true,
 					IsEmbedded:  true,
 					IsStruct:    true,
-					Comment: &ast.CommentGroup{
-						List: []*ast.Comment{
-							{
-								Slash: 524963,
-								Text:  "// embedded pointer",
-							},
-						},
-					},
+					LineComment: "embedded pointer\n",
 				},
 				TypeInfo{
 					PackagePath: testPackagePath,
@@ -172,14 +174,7 @@ var cases = []testCase{
 					Kind:        "error",
 					IsEmbedded:  true,
 					IsInterface: true,
-					Comment: &ast.CommentGroup{
-						List: []*ast.Comment{
-							{
-								Slash: 525003,
-								Text:  "// embedded error",
-							},
-						},
-					},
+					LineComment: "embedded error\n",
 				},
 				TypeInfo{
 					PackagePath: testPackagePath,
@@ -190,6 +185,7 @@ var cases = []testCase{
 					Tags: Tags{
 						&Tag{Key: "json", Name: "name"},
 					},
+					RawTag: `json:"name"`,
 				},
 				TypeInfo{
 					PackagePath: testPackagePath,
@@ -234,7 +230,9 @@ var cases = []testCase{
 					Tags: Tags{
 						&Tag{Key: "json", Name: "itmz"},
 					},
+					RawTag:  `json:"itmz"`,
 					IsArray: true,
+					IsSlice: true,
 				},
 				TypeInfo{
 					PackagePath: testPackagePath,
@@ -245,7 +243,9 @@ var cases = []testCase{
 					Tags: Tags{
 						&Tag{Key: "json", Name: "prcz"},
 					},
+					RawTag:  `json:"prcz"`,
 					IsArray: true,
+					IsSlice: true,
 				},
 			},
 		},
@@ -264,6 +264,7 @@ var cases = []testCase{
 					PackagePath: testPackagePath,
 					Kind:        "Items",
 					IsArray:     true,
+					IsSlice:     true,
 					IsEmbedded:  true,
 				},
 			},
@@ -289,6 +290,7 @@ var cases = []testCase{
 					Tags: Tags{
 						&Tag{Key: "json", Name: "ptr_child"},
 					},
+					RawTag: `json:"ptr_child"`,
 				},
 			},
 		},
@@ -304,14 +306,10 @@ var cases = []testCase{
 			IsPointer:   true,
 			IsArray:     true,
 			IsImported:  true,
-			Comment: &ast.CommentGroup{
-				List: []*ast.Comment{
-					&ast.Comment{
-						Slash: 529859,
-						Text:  "// times comment @time.Time",
-					},
-				},
-			},
+			IsSlice:     true,
+			Item:        &TypeInfo{Package: "time", PackagePath: "time", Kind: "time.Time", IsPointer: true, IsImported: true, IsStruct: true},
+			Doc:         "times comment @time.Time\n",
+			LineComment: "slice of pointer to external\n",
 		},
 	}, // 19 - type ExternalSliceOfPointers []*time.Time
 	{
@@ -324,7 +322,7 @@ var cases = []testCase{
 			Kind:        "time.Ticker",
 			IsPointer:   true,
 			IsImported:  true,
-			IsAlias:     true,
+			LineComment: "external alias\n",
 		},
 	}, // 20 - type ExternalPtrAlias *time.Ticker
 	{
@@ -336,7 +334,8 @@ var cases = []testCase{
 			Name:        "ExternalAlias",
 			Kind:        "time.Ticker",
 			IsImported:  true,
-			IsAlias:     true,
+			IsStruct:    true,
+			LineComment: "external alias\n",
 		},
 	}, // 21 - type ExternalAlias time.Ticker
 	{
@@ -348,7 +347,7 @@ var cases = []testCase{
 			Name:        "BasicPtrAlias",
 			Kind:        "string",
 			IsPointer:   true,
-			IsAlias:     true,
+			LineComment: "pointer to string alias\n",
 		},
 	}, // 22 - type BasicPtrAlias *string
 	{
@@ -359,12 +358,321 @@ var cases = []testCase{
 			PackagePath: testPackagePath,
 			Name:        "BasicAlias",
 			Kind:        "string",
-			IsAlias:     true,
+			LineComment: "string alias\n",
 		},
 	}, // 23 - type BasicAlias string
+	{
+		name:       "p24",
+		outputName: "T19",
+		output: &TypeInfo{
+			Package:     testPackage,
+			PackagePath: testPackagePath,
+			Name:        "T19",
+			Kind:        "T19",
+			Fields: TypesSlice{
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Users",
+					Kind:        "map[string]*S4",
+					IsExported:  true,
+					IsMap:       true,
+					Key:         &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"},
+					Elem:        &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "S4", IsPointer: true, IsStruct: true},
+				},
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Events",
+					Kind:        "chan<- S3",
+					IsExported:  true,
+					IsChan:      true,
+					ChanDir:     "chan<-",
+					Elem:        &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "S3", IsStruct: true},
+				},
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Ticks",
+					Kind:        "<-chan time.Time",
+					IsExported:  true,
+					IsChan:      true,
+					ChanDir:     "<-chan",
+					Elem:        &TypeInfo{Package: "time", PackagePath: "time", Kind: "time.Time", IsImported: true, IsStruct: true},
+				},
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Index",
+					Kind:        "map[S]map[string]int",
+					IsExported:  true,
+					IsMap:       true,
+					Key:         &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "S", IsStruct: true},
+					Elem: &TypeInfo{
+						Package:     testPackage,
+						PackagePath: testPackagePath,
+						Kind:        "map[string]int",
+						IsMap:       true,
+						Key:         &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"},
+						Elem:        &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "int"},
+					},
+				},
+			},
+		},
+	}, // 24 - map and chan fields
+	{
+		name:       "p25",
+		outputName: "Set",
+		output: &TypeInfo{
+			Package:     testPackage,
+			PackagePath: testPackagePath,
+			Name:        "Set",
+			Kind:        "map[string]struct{}",
+			IsMap:       true,
+			Key:         &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "string"},
+			Elem:        &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "struct{}", IsStruct: true},
+		},
+	}, // 25 - type Set map[string]struct{}
+	{
+		name:       "p26",
+		outputName: "Page",
+		output: &TypeInfo{
+			Package:        testPackage,
+			PackagePath:    testPackagePath,
+			Name:           "Page",
+			Kind:           "Page",
+			TypeParams:     TypeParams{{Name: "T", Constraint: "any"}},
+			MethodList:     Methods{pageLen},
+			ValueMethods:   Methods{pageLen},
+			PointerMethods: Methods{pageLen},
+			Fields: TypesSlice{
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Items",
+					Kind:        "T",
+					IsExported:  true,
+					IsArray:     true,
+					IsSlice:     true,
+					IsTypeParam: true,
+					Item:        &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "T", IsTypeParam: true},
+				},
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Total",
+					Kind:        "int",
+					IsExported:  true,
+				},
+			},
+		},
+	}, // 26 - type Page[T any] struct
+	{
+		name:       "p27",
+		outputName: "T20",
+		output: &TypeInfo{
+			Package:     testPackage,
+			PackagePath: testPackagePath,
+			Name:        "T20",
+			Kind:        "T20",
+			Fields: TypesSlice{
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Ints",
+					Kind:        "List",
+					IsExported:  true,
+					IsArray:     true,
+					IsSlice:     true,
+					TypeArgs:    TypesSlice{{Package: testPackage, PackagePath: testPackagePath, Kind: "int"}},
+				},
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Pairs",
+					Kind:        "Pair",
+					IsExported:  true,
+					IsArray:     true,
+					IsSlice:     true,
+					IsStruct:    true,
+					TypeArgs: TypesSlice{
+						{Package: testPackage, PackagePath: testPackagePath, Kind: "string"},
+						{Package: testPackage, PackagePath: testPackagePath, Kind: "S4", IsPointer: true, IsStruct: true},
+					},
+					Item: &TypeInfo{
+						Package:     testPackage,
+						PackagePath: testPackagePath,
+						Kind:        "Pair",
+						IsStruct:    true,
+						TypeArgs: TypesSlice{
+							{Package: testPackage, PackagePath: testPackagePath, Kind: "string"},
+							{Package: testPackage, PackagePath: testPackagePath, Kind: "S4", IsPointer: true, IsStruct: true},
+						},
+					},
+				},
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Paged",
+					Kind:        "Page",
+					IsExported:  true,
+					IsPointer:   true,
+					IsStruct:    true,
+					TypeArgs:    TypesSlice{{Package: testPackage, PackagePath: testPackagePath, Kind: "S3", IsStruct: true}},
+				},
+			},
+		},
+	}, // 27 - instantiated generic fields
+	{
+		name:       "p28",
+		outputName: "IntList",
+		output: &TypeInfo{
+			Package:     testPackage,
+			PackagePath: testPackagePath,
+			Name:        "IntList",
+			Kind:        "List",
+			IsArray:     true,
+			IsSlice:     true,
+			TypeArgs:    TypesSlice{{Package: testPackage, PackagePath: testPackagePath, Kind: "int"}},
+		},
+	}, // 28 - type IntList List[int]
+	{
+		name:       "p29",
+		outputName: "T21",
+		output: &TypeInfo{
+			Package:     testPackage,
+			PackagePath: testPackagePath,
+			Name:        "T21",
+			Kind:        "T21",
+			Fields: TypesSlice{
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Ref",
+					Kind:        "S13",
+					IsExported:  true,
+					IsStruct:    true,
+				},
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Bytes",
+					Kind:        "byte",
+					IsExported:  true,
+					IsArray:     true,
+					Len:         16,
+					Item:        &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "byte"},
+				},
+			},
+		},
+	}, // 29 - field kind named like another field, fixed size array
+	{
+		name:       "p30",
+		outputName: "Shadow",
+		output: &TypeInfo{
+			Package:     testPackage,
+			PackagePath: testPackagePath,
+			Name:        "Shadow",
+			Kind:        "Shadow",
+			Doc:         "a field named like a type shouldn't confuse the kind of other fields\n",
+			Fields: TypesSlice{
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "S13",
+					Kind:        "int",
+					IsExported:  true,
+				},
+			},
+		},
+	}, // 30 - field named like a type
+	{
+		name:       "p31",
+		outputName: "PtrSlices",
+		output: &TypeInfo{
+			Package:     testPackage,
+			PackagePath: testPackagePath,
+			Name:        "PtrSlices",
+			Kind:        "PtrSlices",
+			Doc:         "PtrSlices points to slices and arrays\n",
+			Fields: TypesSlice{
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Ints",
+					Kind:        "int",
+					IsExported:  true,
+					IsPointer:   true,
+					IsArray:     true,
+					IsSlice:     true,
+					Item:        &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "int"},
+				},
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Fixed",
+					Kind:        "int",
+					IsExported:  true,
+					IsPointer:   true,
+					IsArray:     true,
+					Len:         4,
+					Item:        &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "int"},
+				},
+				TypeInfo{
+					Package:     testPackage,
+					PackagePath: testPackagePath,
+					Name:        "Ptrs",
+					Kind:        "int",
+					IsExported:  true,
+					IsPointer:   true,
+					IsArray:     true,
+					IsSlice:     true,
+					Item:        &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: "int", IsPointer: true},
+				},
+			},
+		},
+	}, // 31 - pointers to a slice and to an array, slice of pointers
 }
 
-func TestLoadExamplePackage(t *testing.T) {
+// a single unnamed return of a basic kind
+func returnsOf(kind string) []VarInfo {
+	return []VarInfo{{Kind: kind, TypeString: kind, Info: &TypeInfo{Package: testPackage, PackagePath: testPackagePath, Kind: kind}}}
+}
+
+// `func (p Page[T]) Len() int`
+var pageLen = FunctionInfo{Package: testPackage, PackagePath: testPackagePath, Name: "Len", ReceiverName: "p", ReceiverType: "Page", IsExported: true, Returns: returnsOf("int")}
+
+// positions depend on the layout of the testdata files : they are checked by TestPositions
+func withoutPositions(typeInfo TypeInfo) *TypeInfo {
+	typeInfo.File, typeInfo.Line, typeInfo.Column = "", 0, 0
+	typeInfo.Comment = nil // compared as text, by Doc and LineComment
+	if typeInfo.Fields != nil {
+		fields := make(TypesSlice, len(typeInfo.Fields))
+		for idx := range typeInfo.Fields {
+			fields[idx] = *withoutPositions(typeInfo.Fields[idx])
+		}
+		typeInfo.Fields = fields
+	}
+	methods := func(list Methods) Methods {
+		if list == nil {
+			return nil
+		}
+		result := make(Methods, len(list))
+		for idx, method := range list {
+			method.File, method.Line, method.Column = "", 0, 0
+			result[idx] = method
+		}
+		return result
+	}
+	typeInfo.MethodList = methods(typeInfo.MethodList)
+	typeInfo.ValueMethods = methods(typeInfo.ValueMethods)
+	typeInfo.PointerMethods = methods(typeInfo.PointerMethods)
+	return &typeInfo
+}
+
+// loads and analyses the testdata package
+func analyseTestPackage(t *testing.T) *PackageInfo {
+	t.Helper()
 	loadedPackage, err := LoadPackage(testPackagePath)
 	if err != nil {
 		t.Fatalf("error : %v", err)
@@ -374,17 +682,27 @@ func TestLoadExamplePackage(t *testing.T) {
 	if err := command.Analyse(codeBuilder, loadedPackage); err != nil {
 		t.Fatalf("error : %v", err)
 	}
+	return command.Result
+}
+
+func TestLoadExamplePackage(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
 	for idx := 0; idx < len(cases); idx++ {
 		currentType := cases[idx].outputName
-		resultType := command.Result.Types.Extract(currentType)
+		resultType := pkgInfo.Types.Extract(currentType)
 		if resultType == nil {
 			var knownTypes []string
-			for _, sType := range command.Result.Types {
+			for _, sType := range pkgInfo.Types {
 				knownTypes = append(knownTypes, sType.Kind)
 			}
 			t.Fatalf("error : %q not found in types\nknown types:\n%s", currentType, strings.Join(knownTypes, "\n"))
 		}
-		if compared := halp.Equal(resultType, cases[idx].output); compared != nil {
+		actual := withoutPositions(*resultType)
+		actual.Underlying = nil // see TestAliases
+		if actual.IsImported && actual.IsStruct {
+			actual.Fields = nil // the fields of the structs of other packages change with the go version, see TestAliases
+		}
+		if compared := halp.Equal(actual, cases[idx].output); compared != nil {
 			t.Logf("%d. %#v", idx, compared)
 			t.Fatalf("expected :\n%s\nactual :\n%s\n", halp.SPrint(cases[idx].output), halp.SPrint(resultType))
 		}
@@ -393,6 +711,1367 @@ func TestLoadExamplePackage(t *testing.T) {
 	t.Logf("ran %d tests and finished.", len(cases))
 }
 
+func TestGenerics(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
+	pair := pkgInfo.Types.Extract("Pair")
+	if pair == nil {
+		t.Fatalf("error : Pair not found in types")
+	}
+	if got := pair.TypeParams.Declaration(); got != "[K comparable, V any]" {
+		t.Fatalf("expected `[K comparable, V any]` declaration, got %q", got)
+	}
+	if got := pair.TypeParams.Names(); got != "[K, V]" {
+		t.Fatalf("expected `[K, V]` names, got %q", got)
+	}
+	fields := pkgInfo.Types.Extract("T20").Fields
+	if got := fields[1].RealKind(); got != "Pair[string, *S4]" {
+		t.Fatalf("expected `Pair[string, *S4]` real kind, got %q", got)
+	}
+	if got := fields[2].RealKind(); got != "*Page[S3]" {
+		t.Fatalf("expected `*Page[S3]` real kind, got %q", got)
+	}
+	var found bool
+	for _, fn := range pkgInfo.Functions {
+		if fn.Name != "Map" {
+			continue
+		}
+		found = true
+		if got := fn.TypeParams.Declaration(); got != "[K comparable, V any]" {
+			t.Fatalf("expected `[K comparable, V any]` declaration on Map, got %q", got)
+		}
+	}
+	if !found {
+		t.Fatalf("error : Map not found in functions")
+	}
+}
+
+func TestMethodSets(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
+	names := func(methods Methods) string {
+		var result []string
+		for _, method := range methods {
+			name := method.Name
+			if method.IsPromoted {
+				name += "(promoted)"
+			}
+			result = append(result, name)
+		}
+		return strings.Join(result, ",")
+	}
+	named := pkgInfo.Types.Extract("Named")
+	if got := names(named.MethodList); got != "String,SetName" {
+		t.Fatalf("expected declared methods `String,SetName`, got %q", got)
+	}
+	if got := names(named.ValueMethods); got != "String" {
+		t.Fatalf("expected value methods `String`, got %q", got)
+	}
+	if got := names(named.PointerMethods); got != "SetName,String" {
+		t.Fatalf("expected pointer methods `SetName,String`, got %q", got)
+	}
+	promoted := pkgInfo.Types.Extract("Promoted")
+	if len(promoted.MethodList) != 0 {
+		t.Fatalf("expected no declared methods on Promoted, got %d", len(promoted.MethodList))
+	}
+	if got := names(promoted.ValueMethods); got != "String(promoted)" {
+		t.Fatalf("expected value methods `String(promoted)`, got %q", got)
+	}
+	if got := names(promoted.PointerMethods); got != "SetName(promoted),String(promoted)" {
+		t.Fatalf("expected pointer methods `SetName(promoted),String(promoted)`, got %q", got)
+	}
+	if got := names(pkgInfo.Types.Extract("Namer").ValueMethods); got != "SetName" {
+		t.Fatalf("expected interface methods `SetName`, got %q", got)
+	}
+}
+
+func TestImplements(t *testing.T) {
+	result, err := Generate(context.Background(), Options{
+		Dir:      "testdata",
+		Types:    []string{"Named", "Promoted", "S13"},
+		Template: "templates/implements.tmpl",
+		DryRun:   true,
+	})
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	for _, expected := range []string{
+		"// Named fmt.Stringer=true Namer=true Name:json.Marshaler=false\n",
+		"// Promoted fmt.Stringer=true Namer=true Named:json.Marshaler=false When:json.Marshaler=true\n",
+		"// S13 fmt.Stringer=false Namer=false",
+	} {
+		if !strings.Contains(string(result.Out), expected) {
+			t.Fatalf("expected %q in :\n%s", expected, result.Out)
+		}
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	result, err := Generate(context.Background(), Options{
+		Dir:      "testdata",
+		Types:    []string{"S13"},
+		Template: "templates/typeof.tmpl",
+		DryRun:   true,
+	})
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	for _, expected := range []string{
+		"// stroo:begin Describe people.Person\n// describe people.Person Name:string Home:people.Address Born:time.Time Height:int32 age:int\n",
+		"// by name StructFromAnotherPackage imported=true\n",
+		"// io.Reader Read\n",
+	} {
+		if !strings.Contains(string(result.Out), expected) {
+			t.Fatalf("expected %q in :\n%s", expected, result.Out)
+		}
+	}
+
+	pkgInfo := analyseTestPackage(t)
+	byPath, err := pkgInfo.TypeOf(testPackagePath + "/other.StructFromAnotherPackage")
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	if byName, _ := pkgInfo.TypeOf("other.StructFromAnotherPackage"); byName != byPath {
+		t.Fatalf("expecting the description to be cached")
+	}
+	if local, _ := pkgInfo.TypeOf("S13"); local == nil || halp.Equal(local, pkgInfo.Types.Extract("S13")) != nil {
+		t.Fatalf("expecting the types of the current package to be the ones already read")
+	}
+	if _, err := pkgInfo.TypeOf("people.Person"); err == nil {
+		t.Fatalf("expecting error for a package which is not imported, given by name")
+	}
+	if _, err := pkgInfo.TypeOf("other.Missing"); err == nil {
+		t.Fatalf("expecting error for a missing type")
+	}
+}
+
+func TestHasNotGenerated(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
+	config := CodeConfig{SelectedType: "S13"}
+	// packages are given by name or by path, like for recurseGenerate
+	tmpl, err := template.New("recurse").Funcs(DefaultFuncMap()).Parse(`{{ if declare "Describe" }}{{ end }}
+		{{- define "Describe" }}{{ .Kind }}{{ end }}
+		{{- hasNotGenerated "testdata" "S3" }} {{ hasNotGenerated "` + testPackagePath + `" "S3" }} 
+		{{- " " }}{{ hasNotGenerated "other" "other.StructFromAnotherPackage" }} {{ hasNotGenerated "` + testPackagePath + `/other" "other.StructFromAnotherPackage" }}
+		{{- if recurseGenerate "` + testPackagePath + `" "S3" }}{{ end }}{{ if recurseGenerate "other" "other.StructFromAnotherPackage" }}{{ end }}
+		{{- " " }}{{ hasNotGenerated "testdata" "S3" }} {{ hasNotGenerated "` + testPackagePath + `/other" "other.StructFromAnotherPackage" }} {{ hasNotGenerated "testdata" "S13" }}`)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	code, err := New(pkgInfo, config, tmpl)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	var buf bytes.Buffer
+	if err := code.Tmpl().Execute(&buf, code); err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	if buf.String() != "true true true true false false false" {
+		t.Fatalf("unexpected result : %q", buf.String())
+	}
+}
+
+func TestBadTags(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	// the analysis goes on, the error is reported where the field is declared
+	pkgInfo := analyseTestPackage(t)
+	field := pkgInfo.Types.Extract("BadTag").Fields[0]
+	if field.RawTag != `json:"name" db` || field.Tags != nil {
+		t.Fatalf("unexpected tags %q %v", field.RawTag, field.Tags)
+	}
+	if !strings.Contains(logged.String(), `easy.go:406:2 : field "Name" : bad syntax for struct tag pair at position 14`) {
+		t.Fatalf("expected the position of the field in the error, got :\n%s", logged.String())
+	}
+}
+
+func TestPositions(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
+	source, err := ioutil.ReadFile(filepath.Join("testdata", "easy.go"))
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	lineOf := func(text string) int {
+		for idx, line := range strings.Split(string(source), "\n") {
+			if strings.HasPrefix(line, text) {
+				return idx + 1
+			}
+		}
+		t.Fatalf("%q not found in easy.go", text)
+		return 0
+	}
+	check := func(what, doc, lineComment, file string, line, column int, expectedDoc, expectedLineComment, expectedLine string, expectedColumn int) {
+		if doc != expectedDoc || lineComment != expectedLineComment {
+			t.Fatalf("%s : bad comments %q %q", what, doc, lineComment)
+		}
+		if filepath.Base(file) != "easy.go" || line != lineOf(expectedLine) || column != expectedColumn {
+			t.Fatalf("%s : bad position %s:%d:%d", what, file, line, column)
+		}
+	}
+
+	located := pkgInfo.Types.Extract("Located")
+	if located == nil || len(located.Fields) != 1 {
+		t.Fatalf("bad type : %#v", located)
+	}
+	check("type", located.Doc, located.LineComment, located.File, located.Line, located.Column, "Located is documented, for checking positions\n", "", "type Located struct", 6)
+	field := located.Fields[0]
+	check("field", field.Doc, field.LineComment, field.File, field.Line, field.Column, "ID identifies it\n", "never zero\n", "\tID int", 2)
+	// the doc of a `type ( ... )` group with more types belongs to none of them
+	groupedA, groupedB := pkgInfo.Types.Extract("GroupedA"), pkgInfo.Types.Extract("GroupedB")
+	check("grouped type", groupedA.Doc, groupedA.LineComment, groupedA.File, groupedA.Line, groupedA.Column, "GroupedA has it's own doc\n", "", "\tGroupedA int", 2)
+	check("grouped type", groupedB.Doc, groupedB.LineComment, groupedB.File, groupedB.Line, groupedB.Column, "", "", "\tGroupedB int", 2)
+
+	var locate *FunctionInfo
+	for idx := range pkgInfo.Functions {
+		if pkgInfo.Functions[idx].Name == "Locate" {
+			locate = &pkgInfo.Functions[idx]
+		}
+	}
+	if locate == nil {
+		t.Fatal("function Locate not found")
+	}
+	check("function", locate.Doc, "", locate.File, locate.Line, locate.Column, "Locate has a doc too\n", "", "func Locate()", 6)
+
+	var origin *VarInfo
+	for idx := range pkgInfo.Vars {
+		if pkgInfo.Vars[idx].Name == "Origin" {
+			origin = &pkgInfo.Vars[idx]
+		}
+	}
+	if origin == nil {
+		t.Fatal("var Origin not found")
+	}
+	check("var", origin.Doc, origin.LineComment, origin.File, origin.Line, origin.Column, "Origin is where it starts\n", "the zero value\n", "var Origin", 5)
+
+	// types of other packages have positions too (without comments)
+	person, err := pkgInfo.TypeOf("github.com/badu/stroo/testdata/people.Person")
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	if filepath.Base(person.File) != "person.go" || person.Line == 0 {
+		t.Fatalf("bad position %s:%d", person.File, person.Line)
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
+	describe := func(vars []VarInfo) string {
+		var parts []string
+		for _, variable := range vars {
+			declared := ""
+			if variable.Type != nil {
+				declared = " declared=" + variable.Type.Name
+			}
+			parts = append(parts, fmt.Sprintf("%s %s kind=%s variadic=%t%s", variable.Name, variable.TypeString, variable.Kind, variable.IsVariadic, declared))
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	var join *FunctionInfo
+	for idx := range pkgInfo.Functions {
+		if pkgInfo.Functions[idx].Name == "Join" {
+			join = &pkgInfo.Functions[idx]
+		}
+	}
+	if join == nil {
+		t.Fatal("function Join not found")
+	}
+	// `func Join(sep string, first, second int, rest ...*Located) (joined string, err error)`
+	if got := describe(join.Params); got != "sep string kind=string variadic=false, first int kind=int variadic=false, second int kind=int variadic=false, rest ...*Located kind=Located variadic=true declared=Located" {
+		t.Fatalf("bad params : %s", got)
+	}
+	if rest := join.Params[3].Info; !rest.IsArray || !rest.IsPointer || !rest.IsStruct {
+		t.Fatalf("variadic param should be described as a slice of pointers : %#v", rest)
+	}
+	if got := describe(join.Returns); got != "joined string kind=string variadic=false, err error kind=error variadic=false" {
+		t.Fatalf("bad returns : %s", got)
+	}
+	if !join.Returns[1].Info.IsInterface {
+		t.Fatal("error should be described as an interface")
+	}
+
+	located := pkgInfo.Types.Extract("Located")
+	if located == nil || len(located.MethodList) != 1 {
+		t.Fatalf("bad type : %#v", located)
+	}
+	// `func (l Located) Merge(other Located, extra map[string][]int) Located`
+	merge := located.MethodList[0]
+	if got := describe(merge.Params); got != "other Located kind=Located variadic=false declared=Located, extra map[string][]int kind=map[string][]int variadic=false" {
+		t.Fatalf("bad params : %s", got)
+	}
+	if extra := merge.Params[1].Info; !extra.IsMap || extra.Key.Kind != "string" || !extra.Elem.IsArray || extra.Elem.Kind != "int" {
+		t.Fatalf("bad map param : %#v", extra)
+	}
+	if got := describe(merge.Returns); got != " Located kind=Located variadic=false declared=Located" {
+		t.Fatalf("bad returns : %s", got)
+	}
+
+	// `type Visit func(int, ...string) bool`
+	visit := pkgInfo.Types.Extract("Visit")
+	if visit == nil || len(visit.MethodList) != 1 {
+		t.Fatalf("bad type : %#v", visit)
+	}
+	if got := describe(visit.MethodList[0].Params); got != " int kind=int variadic=false,  ...string kind=string variadic=true" {
+		t.Fatalf("bad params : %s", got)
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
+	describe := func(methods Methods) string {
+		var parts []string
+		for _, method := range methods {
+			parts = append(parts, fmt.Sprintf("%s.%s(%s) %s promoted=%t", method.ReceiverType, method.Name, method.ParamsDeclaration(), method.ReturnsDeclaration(), method.IsPromoted))
+		}
+		return strings.Join(parts, "\n")
+	}
+
+	registry := pkgInfo.Types.Extract("Registry")
+	if registry == nil {
+		t.Fatal("type Registry not found")
+	}
+	// declared methods come first, in order of declaration
+	if got := describe(registry.InterfaceMethods); got != "Registry.Register(key string, items ...T) (int, error) promoted=false\nRegistry.Lookup(p0 string) (T, bool) promoted=false\nNamer.SetName(name string)  promoted=true" {
+		t.Fatalf("bad methods :\n%s", got)
+	}
+	if got := registry.InterfaceMethods[0].Arguments(); got != "key, items..." {
+		t.Fatalf("bad arguments : %s", got)
+	}
+	if got := registry.InterfaceMethods[0].Doc; got != "Register adds the items\n" {
+		t.Fatalf("bad doc : %q", got)
+	}
+	if len(registry.TypeSet) != 0 || registry.IsComparable {
+		t.Fatalf("Registry is not a constraint : %v", registry.TypeSet)
+	}
+
+	for name, expected := range map[string]string{"Number": "~int | ~int64 | float64", "Integer": "int | int64"} {
+		constraint := pkgInfo.Types.Extract(name)
+		if constraint == nil {
+			t.Fatalf("type %s not found", name)
+		}
+		if got := constraint.TypeSet.String(); got != expected || !constraint.IsComparable {
+			t.Fatalf("%s : bad type set %q (comparable %t)", name, got, constraint.IsComparable)
+		}
+	}
+
+	// interfaces of other packages are expanded too
+	readCloser, err := pkgInfo.TypeOf("io.ReadCloser")
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	if got := describe(readCloser.InterfaceMethods); got != "Reader.Read(p []byte) (int, error) promoted=true\nCloser.Close() error promoted=true" {
+		t.Fatalf("bad methods :\n%s", got)
+	}
+}
+
+func TestNestedItems(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
+	// writes the type back from the descriptions of the items (the pointer flag of a field is the one of it's items)
+	var shape func(typeInfo *TypeInfo, isField bool) string
+	shape = func(typeInfo *TypeInfo, isField bool) string {
+		if typeInfo.IsPointer && !isField {
+			pointed := *typeInfo
+			pointed.IsPointer = false
+			return "*" + shape(&pointed, false)
+		}
+		switch {
+		case typeInfo.Item != nil && typeInfo.IsSlice:
+			return "[]" + shape(typeInfo.Item, false)
+		case typeInfo.Item != nil:
+			return fmt.Sprintf("[%d]", typeInfo.Len) + shape(typeInfo.Item, false)
+		case typeInfo.IsMap:
+			return "map[" + shape(typeInfo.Key, false) + "]" + shape(typeInfo.Elem, false)
+		default:
+			return typeInfo.Kind
+		}
+	}
+	nested := pkgInfo.Types.Extract("Nested")
+	if nested == nil {
+		t.Fatal("type Nested not found")
+	}
+	for idx, expected := range []string{"[4][]int", "[][4]int", "[]*[2]map[string][]byte"} {
+		if got := shape(&nested.Fields[idx], true); got != expected {
+			t.Fatalf("%s : expected %s, got %s", nested.Fields[idx].Name, expected, got)
+		}
+	}
+	if grid := nested.Fields[0]; grid.IsSlice || grid.Len != 4 || !grid.Item.IsSlice || grid.Item.Len != 0 {
+		t.Fatalf("bad array of slices : %#v", grid)
+	}
+	if rows := nested.Fields[1]; !rows.IsSlice || rows.Len != 0 || rows.Item.IsSlice || rows.Item.Len != 4 {
+		t.Fatalf("bad slice of arrays : %#v", rows)
+	}
+}
+
+func TestInlineStructs(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
+	config := pkgInfo.Types.Extract("Config")
+	if config == nil || len(config.Fields) != 2 {
+		t.Fatalf("bad type : %#v", config)
+	}
+	tagOf := func(field TypeInfo) string {
+		if tag := field.TagByKey("yaml"); tag != nil {
+			return tag.Name
+		}
+		return ""
+	}
+
+	server := config.Fields[0]
+	if !server.IsStruct || tagOf(server) != "server" || len(server.Fields) != 2 {
+		t.Fatalf("bad inline struct field : %#v", server)
+	}
+	host := server.Fields[0]
+	if host.Name != "Host" || host.Kind != "string" || tagOf(host) != "host" || host.Doc != "Host is where to listen\n" {
+		t.Fatalf("bad field of inline struct : %#v", host)
+	}
+	tls := server.Fields[1]
+	if !tls.IsPointer || tagOf(tls) != "tls" || len(tls.Fields) != 1 {
+		t.Fatalf("bad pointer to inline struct : %#v", tls)
+	}
+	if cert := tls.Fields[0]; cert.Name != "Cert" || tagOf(cert) != "cert" || cert.LineComment != "the certificate file\n" || cert.Line == 0 {
+		t.Fatalf("bad field of nested inline struct : %#v", cert)
+	}
+
+	backends := config.Fields[1]
+	if !backends.IsSlice || tagOf(backends) != "backends" || len(backends.Fields) != 1 || backends.Fields[0].Name != "URL" || tagOf(backends.Fields[0]) != "url" {
+		t.Fatalf("bad slice of inline structs : %#v", backends)
+	}
+	if backends.Item == nil || len(backends.Item.Fields) != 1 || backends.Item.Fields[0].Name != "URL" {
+		t.Fatalf("items should have the fields too : %#v", backends.Item)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
+	for _, expected := range []struct {
+		name       string
+		isAlias    bool
+		kind       string
+		underlying string // empty if there is no underlying type
+	}{
+		{name: "BasicAlias", kind: "string", underlying: "string"},
+		{name: "BasicPtrAlias", kind: "string", underlying: "*string"},
+		{name: "ExternalAlias", kind: "time.Ticker"},
+		{name: "ExternalPtrAlias", kind: "time.Ticker", underlying: "*time.Ticker"},
+		{name: "Items", kind: "Item", underlying: "[]*Item"},
+		{name: "Set", kind: "map[string]struct{}", underlying: "map[string]struct{}"},
+		{name: "IntList", kind: "List", underlying: "[]int"},
+		{name: "T15", kind: "T15"},
+		{name: "Service", kind: "Service"},
+		{name: "Text", isAlias: true, kind: "string", underlying: "string"},
+		{name: "Prices2", isAlias: true, kind: "Price2", underlying: "[]Price2"},
+		{name: "Entry", isAlias: true, kind: "S3"},
+		{name: "DefInner", kind: "Inner"},
+		{name: "AliasInner", isAlias: true, kind: "Inner"},
+	} {
+		typeInfo := pkgInfo.Types.Extract(expected.name)
+		if typeInfo == nil {
+			t.Fatalf("%q not found", expected.name)
+		}
+		if typeInfo.IsAlias != expected.isAlias || typeInfo.Kind != expected.kind {
+			t.Fatalf("%s : expected alias %t of kind %q, got %t of kind %q", expected.name, expected.isAlias, expected.kind, typeInfo.IsAlias, typeInfo.Kind)
+		}
+		underlying := ""
+		if typeInfo.Underlying != nil {
+			underlying = typeInfo.Underlying.TypeString()
+		}
+		if underlying != expected.underlying {
+			t.Fatalf("%s : expected underlying %q, got %q", expected.name, expected.underlying, underlying)
+		}
+	}
+	if underlying := pkgInfo.Types.Extract("BasicAlias").Underlying; !underlying.IsBasic() || underlying.IsPointer {
+		t.Fatalf("bad underlying type : %#v", underlying)
+	}
+	if underlying := pkgInfo.Types.Extract("Set").Underlying; !underlying.IsMap || underlying.Key.Kind != "string" {
+		t.Fatalf("bad underlying type : %#v", underlying)
+	}
+	// the types over a named struct have it's fields
+	for name, expected := range map[string][]string{
+		"DefInner":      {"Values", "Index"},
+		"AliasInner":    {"Values", "Index"},
+		"Entry":         {"Name"},
+		"ExternalAlias": {"C"},
+	} {
+		typeInfo := pkgInfo.Types.Extract(name)
+		if !typeInfo.IsStruct {
+			t.Fatalf("%s : expected a struct", name)
+		}
+		var fields []string
+		for _, field := range typeInfo.Fields {
+			if field.IsExported {
+				fields = append(fields, field.Name)
+			}
+		}
+		if strings.Join(fields, ",") != strings.Join(expected, ",") {
+			t.Fatalf("%s : expected fields %v, got %v", name, expected, fields)
+		}
+	}
+	if values := pkgInfo.Types.Extract("DefInner").Fields.Extract("Values"); values == nil || !values.IsSlice || values.Kind != "int" {
+		t.Fatalf("bad field : %#v", values)
+	}
+}
+
+func TestPeer(t *testing.T) {
+	for _, target := range []string{"./people/Person", "github.com/badu/stroo/testdata/people.Person"} {
+		result, err := Generate(context.Background(), Options{
+			Dir:      "testdata",
+			Types:    []string{"PersonDTO"},
+			Template: "templates/peer.tmpl",
+			Target:   target,
+			DryRun:   true,
+		})
+		if err != nil {
+			t.Fatalf("%s error : %v", target, err)
+		}
+		for _, expected := range []string{
+			"// peer people.Person\n",
+			"// FullName <- Name by=tag convert=v\n",
+			"// Birthday <- Born by=mapping convert=v\n",
+			"// Street <-  by= convert=\n",
+			"// Height <- Height by=name convert=int32(v)\n",
+			"//  <- Home by= convert=\n",
+		} {
+			if !strings.Contains(string(result.Out), expected) {
+				t.Fatalf("%s : expected %q in :\n%s", target, expected, result.Out)
+			}
+		}
+		if strings.Contains(string(result.Out), "<- age") {
+			t.Fatalf("%s : unexported fields of other packages should be left out :\n%s", target, result.Out)
+		}
+	}
+	if _, err := Generate(context.Background(), Options{
+		Dir:      "testdata",
+		Types:    []string{"PersonDTO"},
+		Template: "templates/peer.tmpl",
+		Target:   "./people/Missing",
+		DryRun:   true,
+	}); err == nil {
+		t.Fatalf("expecting error for a missing target")
+	}
+}
+
+func TestClone(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
+	for _, name := range []string{"Pair", "Named", "Entry", "Config", "Weekday"} {
+		original := pkgInfo.Types.Extract(name)
+		clone := original.Clone(original.Name)
+		if compared := halp.Equal(&clone, original); compared != nil {
+			t.Fatalf("%s : clone differs %v\nexpected :\n%s\nactual :\n%s\n", name, compared, halp.SPrint(original), halp.SPrint(&clone))
+		}
+		if clone.TypeString() != original.TypeString() {
+			t.Fatalf("%s : expected type string %q, got %q", name, original.TypeString(), clone.TypeString())
+		}
+	}
+	named := pkgInfo.Types.Extract("Named")
+	if len(named.MethodList) == 0 {
+		t.Fatalf("Named should have methods")
+	}
+	clone := named.Clone("Other")
+	clone.MethodList[0].Name = "Changed"
+	if clone.Name != "Other" || named.MethodList[0].Name == "Changed" {
+		t.Fatalf("the clone should have it's own name and methods")
+	}
+}
+
+func TestEnums(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
+	weekday := pkgInfo.Types.Extract("Weekday")
+	if weekday == nil || !weekday.IsEnum() {
+		t.Fatalf("error : Weekday should be an enum")
+	}
+	expected := Consts{
+		{Name: "Sunday", Value: "0", Iota: 0, IsExported: true, Doc: "Sunday starts the week\n"},
+		{Name: "Monday", Value: "1", Iota: 1, IsExported: true},
+		{Name: "Tuesday", Value: "2", Iota: 2, IsExported: true},
+		{Name: "Friday", Value: "4", Iota: 4, IsExported: true, LineComment: "comes after the skipped ones\n"},
+		{Name: "Weekend", Value: "0", Iota: 5, IsExported: true, IsDuplicate: true},
+	}
+	if len(weekday.Consts) != len(expected) {
+		t.Fatalf("expected %d constants, got %d", len(expected), len(weekday.Consts))
+	}
+	if sunday := weekday.Consts[0]; filepath.Base(sunday.File) != "easy.go" || sunday.Line != 273 || sunday.Column != 2 {
+		t.Fatalf("unexpected position of Sunday : %s:%d:%d", sunday.File, sunday.Line, sunday.Column)
+	}
+	for idx, constant := range weekday.Consts {
+		constant.Comment = nil
+		constant.File, constant.Line, constant.Column = "", 0, 0
+		if constant != expected[idx] {
+			t.Fatalf("expected %#v, got %#v", expected[idx], constant)
+		}
+	}
+	if got := weekday.Consts[0].Comment.Text(); got != "Sunday starts the week\n" {
+		t.Fatalf("expected doc comment on Sunday, got %q", got)
+	}
+	if got := weekday.Consts[3].Comment.Text(); got != "comes after the skipped ones\n" {
+		t.Fatalf("expected line comment on Friday, got %q", got)
+	}
+	if got := len(weekday.Consts.Unique()); got != 4 {
+		t.Fatalf("expected 4 unique constants, got %d", got)
+	}
+
+	level := pkgInfo.Types.Extract("Level")
+	var values []string
+	for _, constant := range level.Consts {
+		values = append(values, constant.Name+"="+constant.Value)
+	}
+	if got := strings.Join(values, ","); got != `Debug="debug",Info="info",Error="error"` {
+		t.Fatalf("unexpected Level constants %s", got)
+	}
+	if pkgInfo.Types.Extract("S13").IsEnum() {
+		t.Fatalf("S13 should not be an enum")
+	}
+}
+
+func TestSelectTypes(t *testing.T) {
+	loadedPackage, err := LoadPackage(testPackagePath)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	for _, tc := range []struct {
+		selectedType string
+		marker       string
+		expected     []string
+	}{
+		{selectedType: "T0,T1", expected: []string{"T0", "T1"}},
+		{selectedType: "T1*", expected: []string{"T1", "T10", "T11", "T12", "T13", "T14", "T15", "T16", "T17", "T18", "T19"}},
+		{marker: "stroo:json", expected: []string{"Marked", "Tagged"}},
+		{selectedType: "S13", marker: "stroo:json", expected: []string{"S13", "Marked", "Tagged"}},
+	} {
+		codeBuilder := DefaultAnalyzer()
+		if err := codeBuilder.Flags.Set("type", tc.selectedType); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		if err := codeBuilder.Flags.Set("marker", tc.marker); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		command := NewCommand(codeBuilder)
+		if err := command.Analyse(codeBuilder, loadedPackage); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		selected, err := command.SelectTypes()
+		if err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		var names []string
+		for _, selectedType := range selected {
+			names = append(names, selectedType.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tc.expected, ",") {
+			t.Fatalf("-type=%s -marker=%s : expected %v, got %v", tc.selectedType, tc.marker, tc.expected, names)
+		}
+	}
+}
+
+func TestGenerateMultipleTypes(t *testing.T) {
+	loadedPackage, err := LoadPackage(testPackagePath)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	for _, output := range []string{"multiple_gen.go", "{{.Kind | snakecase}}_gen.go"} {
+		codeBuilder := DefaultAnalyzer()
+		for flagName, value := range map[string]string{
+			"type":     "S13,T18",
+			"template": "./templates/stringer.tmpl",
+			"output":   output,
+			"testMode": "true",
+		} {
+			if err := codeBuilder.Flags.Set(flagName, value); err != nil {
+				t.Fatalf("error : %v", err)
+			}
+		}
+		command := NewCommand(codeBuilder)
+		if err := command.Analyse(codeBuilder, loadedPackage); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		if err := command.Generate(codeBuilder); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		for _, expected := range []string{"func (st S13) String() string", "func (st T18) String() string"} {
+			if !strings.Contains(command.Out.String(), expected) {
+				t.Fatalf("expected %q in output %q :\n%s", expected, output, command.Out.String())
+			}
+		}
+	}
+}
+
+func TestParseDirective(t *testing.T) {
+	directive, err := ParseDirective(` template=stringer.tmpl output=zz_string.go receiver=s title="a \"quoted\" value"`)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	expected := Directive{
+		Template: "stringer.tmpl",
+		Output:   "zz_string.go",
+		Options: map[string]string{
+			"template": "stringer.tmpl",
+			"output":   "zz_string.go",
+			"receiver": "s",
+			"title":    `a "quoted" value`,
+		},
+	}
+	if compared := halp.Equal(directive, expected); compared != nil {
+		t.Fatalf("directive is different : %v", compared)
+	}
+	for _, bad := range []string{
+		"output=zz_string.go",
+		"template=stringer.tmpl",
+		"template=a.tmpl output=b.go template=c.tmpl",
+		"template=a.tmpl output=b.go receiver",
+		`template=a.tmpl output=b.go title="unterminated`,
+	} {
+		if _, err := ParseDirective(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestRecurseOncePerRun(t *testing.T) {
+	for _, options := range []Options{
+		{Dir: "testdata/copies", Types: []string{"Left", "Right"}, Template: BuiltinPrefix + "deep-copy", Output: "{{.Kind | snakecase}}_gen.go", DryRun: true},
+		{Dir: "testdata/copies", Directives: true, DryRun: true},
+	} {
+		result, err := Generate(context.Background(), options)
+		if err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		if len(result.Outputs) != 2 {
+			t.Fatalf("expected two files, got %v", result.Outputs)
+		}
+		// Shared is written in one of the files, Left only in it's own
+		for _, method := range []string{"func (st *Shared) DeepCopy()", "func (st *Left) DeepCopy()", "func (st *Right) DeepCopy()"} {
+			if got := strings.Count(string(result.Out), method); got != 1 {
+				t.Fatalf("expected %q once, got %d :\n%s", method, got, result.Out)
+			}
+		}
+	}
+}
+
+func TestGenerateDirectives(t *testing.T) {
+	loadedPackage, err := LoadPackage(testPackagePath)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	codeBuilder := DefaultAnalyzer()
+	for flagName, value := range map[string]string{
+		"directives": "true",
+		"testMode":   "true",
+	} {
+		if err := codeBuilder.Flags.Set(flagName, value); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+	}
+	command := NewCommand(codeBuilder)
+	if err := command.Analyse(codeBuilder, loadedPackage); err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	if err := command.GenerateDirectives(codeBuilder); err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	for _, expected := range []string{"func (st Directed) String() string", "func (st AlsoDirected) String() string"} {
+		if !strings.Contains(command.Out.String(), expected) {
+			t.Fatalf("expected %q in output :\n%s", expected, command.Out.String())
+		}
+	}
+	if strings.Count(command.Out.String(), "package testdata") != 1 {
+		t.Fatalf("expected one file for both types :\n%s", command.Out.String())
+	}
+}
+
+func TestGenerateAll(t *testing.T) {
+	loadedPackages, err := LoadPackages(testPackagePath, testPackagePath+"/other") // `testdata/...` matches nothing, go tools skip testdata folders
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	if len(loadedPackages) != 2 {
+		t.Fatalf("expecting two packages, got %d", len(loadedPackages))
+	}
+	codeBuilder := DefaultAnalyzer()
+	for flagName, value := range map[string]string{
+		"type":     "*AnotherPackage",
+		"template": "./templates/stringer.tmpl",
+		"output":   "another_gen.go",
+		"testMode": "true",
+	} {
+		if err := codeBuilder.Flags.Set(flagName, value); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+	}
+	command := NewCommand(codeBuilder)
+	reports := command.GenerateAll(codeBuilder, loadedPackages)
+	for _, report := range reports {
+		if report.Err != nil {
+			t.Fatalf("error in %q : %v", report.Path, report.Err)
+		}
+		switch report.Path {
+		case testPackagePath:
+			if !report.Skipped {
+				t.Fatalf("expecting %q to be skipped", report.Path)
+			}
+		case testPackagePath + "/other":
+			if len(report.Outputs) != 1 || !strings.HasSuffix(report.Outputs[0], filepath.Join("testdata", "other", "another_gen.go")) {
+				t.Fatalf("bad outputs : %v", report.Outputs)
+			}
+		default:
+			t.Fatalf("unexpected package %q", report.Path)
+		}
+	}
+	if !strings.Contains(command.Out.String(), "func (st StructFromAnotherPackage) String() string") {
+		t.Fatalf("unexpected output :\n%s", command.Out.String())
+	}
+}
+
+func TestMergeGenerated(t *testing.T) {
+	const header = "// Generated on Mon Jan 1 00:00:00 " + HeaderSignature + "\n"
+	existing := header + `
+package testdata
+
+// stroo:begin String A
+func (st A) String() string { return "old" }
+// stroo:end
+
+// hand written, kept between regions
+func (st A) Other() string { return "mine" }
+`
+	generated := "// Generated on Tue Jan 2 00:00:00 " + HeaderSignature + "\n" + `
+package testdata
+
+import "strings"
+
+// stroo:begin String A
+func (st A) String() string { return strings.ToUpper("new") }
+// stroo:end
+
+// stroo:begin String B
+func (st B) String() string { return "b" }
+// stroo:end
+`
+	merged, err := MergeGenerated([]byte(existing), []byte(generated), "String", false)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	for _, expected := range []string{"Tue Jan 2", `import "strings"`, `strings.ToUpper("new")`, `return "mine"`, `func (st B) String() string { return "b" }`} {
+		if !strings.Contains(string(merged), expected) {
+			t.Fatalf("expected %q in merged :\n%s", expected, merged)
+		}
+	}
+	if strings.Contains(string(merged), `"old"`) || strings.Contains(string(merged), "Mon Jan 1") {
+		t.Fatalf("old region or header was kept :\n%s", merged)
+	}
+	// regions of the template which are not generated anymore are dropped, the ones of other templates are kept
+	withOthers := existing + "\n// stroo:begin String Removed\nfunc (st Removed) String() string { return \"removed\" }\n// stroo:end\n" +
+		"\n// stroo:begin Equal A\nfunc (st A) Equal(other A) bool { return true }\n// stroo:end\n"
+	merged, err = MergeGenerated([]byte(withOthers), []byte(generated), "String", false)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	if strings.Contains(string(merged), "Removed") || !strings.Contains(string(merged), "func (st A) Equal(other A) bool") {
+		t.Fatalf("stale region kept or region of other template dropped :\n%s", merged)
+	}
+
+	handWritten := []byte("package testdata\n\nfunc (st A) String() string { return \"mine\" }\n")
+	if _, err := MergeGenerated(handWritten, []byte(generated), "String", false); !errors.Is(err, ErrNotGenerated) {
+		t.Fatalf("expecting ErrNotGenerated, got %v", err)
+	}
+	forced, err := MergeGenerated(handWritten, []byte(generated), "String", true)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	if string(forced) != generated {
+		t.Fatalf("forced file without regions should be overwritten :\n%s", forced)
+	}
+
+	if _, err := MergeGenerated([]byte(header+"// stroo:begin String A\n"), []byte(generated), "String", false); err == nil {
+		t.Fatal("expecting error for region which is not closed")
+	}
+}
+
+func TestRegionsRefresh(t *testing.T) {
+	loadedPackage, err := LoadPackage(testPackagePath)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	dir := t.TempDir()
+	templateFile, outputFile := filepath.Join(dir, "describe.tmpl"), filepath.Join(dir, "describe_gen.go")
+	const tmpl = `{{ if declare "Describe" }}{{ end -}}
+package testdata
+
+// how many types were described
+const describedTypes = {{ len .SelectedTypes }}
+{{ range .SelectedTypes }}
+{{ regionBegin . }}
+// describe {{ . }}
+{{ regionEnd }}
+{{ end }}`
+	if err := ioutil.WriteFile(templateFile, []byte(tmpl), 0644); err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	generate := func(types string) string {
+		codeBuilder := DefaultAnalyzer()
+		for flagName, value := range map[string]string{"type": types, "template": templateFile, "output": outputFile} {
+			if err := codeBuilder.Flags.Set(flagName, value); err != nil {
+				t.Fatalf("error : %v", err)
+			}
+		}
+		command := NewCommand(codeBuilder)
+		if err := command.Analyse(codeBuilder, loadedPackage); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		if err := command.Generate(codeBuilder); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		written, err := ioutil.ReadFile(outputFile)
+		if err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		return string(written)
+	}
+
+	first := generate("S13,S3")
+	for _, expected := range []string{"// stroo:begin Describe\n", "const describedTypes = 2", "// describe S3"} {
+		if !strings.Contains(first, expected) {
+			t.Fatalf("expected %q in :\n%s", expected, first)
+		}
+	}
+	handWritten := first + "\n// hand written\nfunc handWritten() {}\n"
+	if err := ioutil.WriteFile(outputFile, []byte(handWritten), 0644); err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	// S3 is not selected anymore : it's region goes away, the code outside the regions is refreshed
+	second := generate("S13")
+	for _, expected := range []string{"const describedTypes = 1", "// describe S13", "func handWritten() {}"} {
+		if !strings.Contains(second, expected) {
+			t.Fatalf("expected %q in :\n%s", expected, second)
+		}
+	}
+	for _, unexpected := range []string{"describedTypes = 2", "S3"} {
+		if strings.Contains(second, unexpected) {
+			t.Fatalf("unexpected %q in :\n%s", unexpected, second)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n"
+	new := "a\nb\nc\nD\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	expected := `--- old
++++ new
+@@ -1,7 +1,7 @@
+ a
+ b
+ c
+-d
++D
+ e
+ f
+ g
+@@ -9,3 +9,4 @@
+ i
+ j
+ k
++l
+`
+	if diff := UnifiedDiff("old", "new", []byte(old), []byte(new)); diff != expected {
+		t.Fatalf("unexpected diff :\n%s", diff)
+	}
+	if diff := UnifiedDiff("old", "new", []byte(old), []byte(old)); diff != "" {
+		t.Fatalf("expecting no diff, got :\n%s", diff)
+	}
+	// big files : the memory used doesn't grow with the product of the lengths
+	var bigOld, bigNew strings.Builder
+	for i := 0; i < 20000; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		bigOld.WriteString(line)
+		if i%2000 == 0 {
+			line = fmt.Sprintf("changed %d\n", i)
+		}
+		bigNew.WriteString(line)
+	}
+	if hunks := strings.Count(UnifiedDiff("old", "new", []byte(bigOld.String()), []byte(bigNew.String())), "\n@@ "); hunks != 10 {
+		t.Fatalf("expecting 10 hunks, got %d", hunks)
+	}
+}
+
+func TestCheckMode(t *testing.T) {
+	loadedPackage, err := LoadPackage(testPackagePath)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	outputFile := filepath.Join(t.TempDir(), "check_gen.go")
+	generate := func(mode string) *Command {
+		codeBuilder := DefaultAnalyzer()
+		for flagName, value := range map[string]string{
+			"type":     "T18,S13",
+			"template": "./templates/stringer.tmpl",
+			"output":   outputFile,
+			mode:       "true",
+		} {
+			if err := codeBuilder.Flags.Set(flagName, value); err != nil {
+				t.Fatalf("error : %v", err)
+			}
+		}
+		command := NewCommand(codeBuilder)
+		if err := command.Analyse(codeBuilder, loadedPackage); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		if err := command.Generate(codeBuilder); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		return command
+	}
+
+	stale := generate("check")
+	if len(stale.Stale) != 1 || !strings.Contains(stale.Out.String(), "+package testdata") {
+		t.Fatalf("missing file should be stale :\n%s", stale.Out.String())
+	}
+	// output is the same on every run
+	first, second := generate("testMode"), generate("testMode")
+	if first.Out.String() != second.Out.String() {
+		t.Fatalf("output differs between runs :\n%s\n%s", first.Out.String(), second.Out.String())
+	}
+	if err := ioutil.WriteFile(outputFile, first.Out.Bytes(), 0644); err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	if upToDate := generate("check"); len(upToDate.Stale) != 0 {
+		t.Fatalf("file should be up to date :\n%s", upToDate.Out.String())
+	}
+}
+
+func TestPostProcess(t *testing.T) {
+	src := "// header\n\npackage testdata\n\nfunc (st S) String() string { var sb strings.Builder; return sb.String() + strconv.Itoa(1) }\n"
+	processed, err := PostProcess(filepath.Join("testdata", "zz_gen.go"), []byte(src), []string{"strings", "fmt"})
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	for _, expected := range []string{"// header", `"strings"`, `"strconv"`} {
+		if !strings.Contains(string(processed), expected) {
+			t.Fatalf("expected %q in :\n%s", expected, processed)
+		}
+	}
+	if strings.Contains(string(processed), `"fmt"`) {
+		t.Fatalf("unused import was kept :\n%s", processed)
+	}
+}
+
+// run with -race : codes don't share anything
+func TestConcurrentGeneration(t *testing.T) {
+	loadedPackage, err := LoadPackage(testPackagePath)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	generate := func(typeName string) (string, error) {
+		codeBuilder := DefaultAnalyzer()
+		for flagName, value := range map[string]string{
+			"type":     typeName,
+			"template": "./templates/stringer.tmpl",
+			"testMode": "true",
+		} {
+			if err := codeBuilder.Flags.Set(flagName, value); err != nil {
+				return "", err
+			}
+		}
+		command := NewCommand(codeBuilder)
+		if err := command.Analyse(codeBuilder, loadedPackage); err != nil {
+			return "", err
+		}
+		if err := command.Generate(codeBuilder); err != nil {
+			return "", err
+		}
+		return command.Out.String(), nil
+	}
+	typeNames := []string{"S13", "T18", "T19", "Directed", "S13", "T18"}
+	expected := make([]string, len(typeNames))
+	for idx, typeName := range typeNames {
+		if expected[idx], err = generate(typeName); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+	}
+	results := make([]string, len(typeNames))
+	errs := make([]error, len(typeNames))
+	var wg sync.WaitGroup
+	for idx, typeName := range typeNames {
+		wg.Add(1)
+		go func(idx int, typeName string) {
+			defer wg.Done()
+			results[idx], errs[idx] = generate(typeName)
+		}(idx, typeName)
+	}
+	wg.Wait()
+	for idx := range typeNames {
+		if errs[idx] != nil {
+			t.Fatalf("error : %v", errs[idx])
+		}
+		if results[idx] != expected[idx] {
+			t.Fatalf("concurrent generation of %q differs :\n%s\n%s", typeNames[idx], results[idx], expected[idx])
+		}
+	}
+}
+
+func TestSortCopies(t *testing.T) {
+	pkgInfo := analyseTestPackage(t)
+	config := CodeConfig{SelectedType: "PtrSlices"}
+	tmpl, err := template.New("sorted").Funcs(DefaultFuncMap()).Parse(`{{ range sort (structByKey "PtrSlices").Fields }}{{ .Name }} {{ end }}`)
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	// like the playground, the generations share the analysis
+	for i := 0; i < 2; i++ {
+		code, err := New(pkgInfo, config, tmpl)
+		if err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		var buf bytes.Buffer
+		if err := code.Tmpl().Execute(&buf, code); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		if buf.String() != "Fixed Ints Ptrs " {
+			t.Fatalf("fields are not sorted : %q", buf.String())
+		}
+	}
+	var names []string
+	for _, field := range pkgInfo.Types.Extract("PtrSlices").Fields {
+		names = append(names, field.Name)
+	}
+	if strings.Join(names, " ") != "Ints Fixed Ptrs" {
+		t.Fatalf("sorting changed the analysis : %v", names)
+	}
+}
+
+func TestGenerateAPI(t *testing.T) {
+	result, err := Generate(context.Background(), Options{
+		Dir:      "testdata",
+		Patterns: []string{".", "./other"},
+		Types:    []string{"S13", "*AnotherPackage"},
+		Template: "../templates/stringer.tmpl",
+		DryRun:   true,
+	})
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	if len(result.Packages) != 2 {
+		t.Fatalf("expecting two packages, got %d", len(result.Packages))
+	}
+	for _, expected := range []string{"func (st S13) String() string", "func (st StructFromAnotherPackage) String() string"} {
+		if !strings.Contains(string(result.Out), expected) {
+			t.Fatalf("expected %q in :\n%s", expected, result.Out)
+		}
+	}
+
+	if _, err := Generate(context.Background(), Options{Types: []string{"S13"}}); err == nil {
+		t.Fatal("expecting error for missing template")
+	}
+	// a misspelled type fails, it's not a package where there is nothing to generate
+	result, err = Generate(context.Background(), Options{Dir: "testdata", Types: []string{"Missing"}, Template: "../templates/stringer.tmpl", DryRun: true})
+	if err == nil || errors.Is(err, ErrNothingSelected) || !strings.Contains(err.Error(), `no type matches "Missing"`) {
+		t.Fatalf("expecting no type matches error, got %v", err)
+	}
+	if result.Packages[0].Skipped || result.Packages[0].Err == nil {
+		t.Fatalf("expecting the package to fail, got %#v", result.Packages[0])
+	}
+	// in many packages, a pattern may match nothing in some of them, but not in all
+	result, err = Generate(context.Background(), Options{
+		Dir:      "testdata",
+		Patterns: []string{".", "./other"},
+		Types:    []string{"S13", "Missing"},
+		Template: "../templates/stringer.tmpl",
+		DryRun:   true,
+	})
+	if err == nil || !strings.Contains(err.Error(), `no type matches "Missing" in the packages`) {
+		t.Fatalf("expecting no type matches error, got %v", err)
+	}
+	if len(result.Outputs) != 1 {
+		t.Fatalf("expecting S13 to be generated, got %v", result.Outputs)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+	}
+	write("go.mod", "module watched\n\ngo 1.18\n")
+	write("model.go", "package watched\n\ntype Model struct {\n\tName string\n}\n")
+	write("fields.tmpl", "{{ range (structByKey \"Model\").Fields }}// field {{ .Name }}\n{{ end }}")
+	codeBuilder := DefaultAnalyzer()
+	for flagName, value := range map[string]string{
+		"type":     "Model",
+		"template": filepath.Join(dir, "fields.tmpl"),
+		"output":   "model_gen.go",
+	} {
+		if err := codeBuilder.Flags.Set(flagName, value); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+	}
+	command := NewCommand(codeBuilder)
+	command.WorkingDir = dir
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runs := make(chan error, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- command.WatchAll(ctx, codeBuilder, []string{"."}, func(reports []PackageReport, err error) {
+			if err == nil && (len(reports) != 1 || reports[0].Err != nil) {
+				err = fmt.Errorf("bad reports : %v", reports)
+			}
+			runs <- err
+		})
+	}()
+	waitFor := func(expected string) {
+		select {
+		case err := <-runs:
+			if err != nil {
+				t.Fatalf("error : %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timeout waiting for %q", expected)
+		}
+		generated, err := ioutil.ReadFile(filepath.Join(dir, "model_gen.go"))
+		if err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		if !strings.Contains(string(generated), expected) {
+			t.Fatalf("expected %q in :\n%s", expected, generated)
+		}
+	}
+
+	waitFor("// field Name")
+	// writing the output doesn't trigger another generation
+	select {
+	case <-runs:
+		t.Fatal("generated output should not be watched")
+	case <-time.After(time.Second):
+	}
+	// templates are generated again, without reloading
+	write("fields.tmpl", "{{ range (structByKey \"Model\").Fields }}// changed {{ .Name }}\n{{ end }}")
+	waitFor("// changed Name")
+	// go files are loaded again
+	write("model.go", "package watched\n\ntype Model struct {\n\tName string\n\tAge  int\n}\n")
+	waitFor("// changed Age")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("error : %v", err)
+	}
+}
+
+func TestTemplatePartials(t *testing.T) {
+	for _, options := range []Options{
+		{Template: "templates/greeter.tmpl", TemplatesDir: "templates/partials"},
+		{Template: "templates/greeter.tmpl,templates/partials/greet.tmpl"},
+		{Template: "templates/partials,templates/greeter.tmpl", Entry: "greeter.tmpl"},
+		{Template: "templates/*.tmpl", TemplatesDir: "templates/partials"},
+	} {
+		options.Dir = "testdata"
+		options.Types = []string{"S13"}
+		options.DryRun = true
+		result, err := Generate(context.Background(), options)
+		if err != nil {
+			t.Fatalf("error : %v", err)
+		}
+		if !strings.Contains(string(result.Out), `func (st S13) Greet() string { return "hello S13" }`) {
+			t.Fatalf("unexpected output for %q :\n%s", options.Template, result.Out)
+		}
+	}
+	if _, err := Generate(context.Background(), Options{Dir: "testdata", Types: []string{"S13"}, DryRun: true, Template: "templates/greeter.tmpl", Entry: "missing"}); err == nil {
+		t.Fatal("expecting error for missing entry template")
+	}
+	// a partial named as the entry would replace it
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "partials"), 0755); err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	for _, name := range []string{"common.tmpl", filepath.Join("partials", "common.tmpl")} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("// "+name+"\n"), 0644); err != nil {
+			t.Fatalf("error : %v", err)
+		}
+	}
+	_, err := Generate(context.Background(), Options{Dir: "testdata", Types: []string{"S13"}, DryRun: true, Template: filepath.Join(dir, "common.tmpl"), TemplatesDir: filepath.Join(dir, "partials")})
+	if err == nil || !strings.Contains(err.Error(), `have the same name "common.tmpl"`) {
+		t.Fatalf("expecting error for templates with the same name, got %v", err)
+	}
+}
+
+// every builtin template generates code which compiles along the package
+func TestBuiltinTemplates(t *testing.T) {
+	builtins, err := BuiltinTemplates()
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	if len(builtins) == 0 {
+		t.Fatal("no builtin templates")
+	}
+	testdataDir, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	for _, builtin := range builtins {
+		result, err := Generate(context.Background(), Options{
+			Dir:      "testdata",
+			Types:    []string{"Everything", "S13", "Page", "Weekday", "Level", "Service", "Registry", "Integer", "Config", "PtrSlices", "T16", "T15", "Inner", "DefInner", "AliasInner"},
+			Template: BuiltinPrefix + builtin.Name,
+			DryRun:   true,
+		})
+		if err != nil {
+			t.Fatalf("%s error : %v", builtin.Name, err)
+		}
+		loaded, err := packages.Load(&packages.Config{
+			Mode:    packages.NeedName | packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo,
+			Dir:     testdataDir,
+			Overlay: map[string][]byte{filepath.Join(testdataDir, "zz_builtin_gen.go"): result.Out},
+		}, ".")
+		if err != nil {
+			t.Fatalf("%s error : %v", builtin.Name, err)
+		}
+		for _, pkgErr := range loaded[0].Errors {
+			t.Errorf("%s generated code doesn't compile : %v", builtin.Name, pkgErr)
+		}
+		// the methods of an alias are the ones of the aliased type
+		if !strings.Contains(string(result.Out), "// AliasInner is an alias of Inner : it has it's methods\n") {
+			t.Errorf("%s : expected the alias to be skipped", builtin.Name)
+		}
+		if t.Failed() {
+			t.Fatalf("generated :\n%s", result.Out)
+		}
+	}
+}
+
+func TestBuiltinDefinedOverStruct(t *testing.T) {
+	for builtin, expected := range map[string][]string{
+		"deep-copy":      {"func (st *DefInner) DeepCopy() *DefInner {", "make([]int, len(result.Values))", "make(map[string]int, len(result.Index))"},
+		"json-marshal":   {"func (st DefInner) MarshalJSON() ([]byte, error) {", `"\"Values\":"`},
+		"json-unmarshal": {"func (st *DefInner) UnmarshalJSON(data []byte) error {", `raw["Index"]`},
+	} {
+		result, err := Generate(context.Background(), Options{
+			Dir:      "testdata",
+			Types:    []string{"DefInner"},
+			Template: BuiltinPrefix + builtin,
+			DryRun:   true,
+		})
+		if err != nil {
+			t.Fatalf("%s error : %v", builtin, err)
+		}
+		for _, code := range expected {
+			if !strings.Contains(string(result.Out), code) {
+				t.Fatalf("%s : expected %q in :\n%s", builtin, code, result.Out)
+			}
+		}
+	}
+}
+
+func TestBuiltinJSONDuplicatedKeys(t *testing.T) {
+	for _, builtin := range []string{"json-marshal", "json-unmarshal"} {
+		_, err := Generate(context.Background(), Options{
+			Dir:      "testdata",
+			Types:    []string{"Contact"},
+			Template: BuiltinPrefix + builtin,
+			DryRun:   true,
+		})
+		if err == nil || !strings.Contains(err.Error(), `more than one field for the key "mail"`) {
+			t.Fatalf("%s : expected the duplicated key to fail the generation, got %v", builtin, err)
+		}
+	}
+}
+
 func TestLoadWithExternal(t *testing.T) {
 	wd, _ := os.Getwd()
 	file1, err := ioutil.ReadFile(wd + "/testdata/pkg/model_a/easy.go")
@@ -0,0 +1,165 @@
+package stroo
+
+import (
+	"fmt"
+	"go/types"
+	"golang.org/x/tools/go/packages"
+	"strings"
+)
+
+const (
+	MatchedByMapping = "mapping" // the pair was given explicitly, e.g. `FullName=Name`
+	MatchedByTag     = "tag"     // both fields have the same tag name, e.g. `json:"name"`
+	MatchedByName    = "name"    // the fields have the same name (case insensitive)
+)
+
+// FieldMatch pairs a field of a type with a field of it's peer (see MatchFields)
+type FieldMatch struct {
+	Field         *TypeInfo // nil if the peer field has no match
+	Peer          *TypeInfo // nil if the field has no match
+	MatchedBy     string    // MatchedByMapping, MatchedByTag or MatchedByName (empty if there is no match)
+	IsAssignable  bool      // the field can be assigned to the peer field as it is
+	IsConvertible bool      // the field can be converted to the kind of the peer field, e.g. `int32(v)`
+}
+
+type FieldMatches []FieldMatch
+
+// the expression which turns the field value into the peer field kind, e.g. `int32(src.Count)`.
+// Empty if there is no match or the kinds are not compatible (e.g. nested structs)
+func (m FieldMatch) Convert(expr string) string {
+	switch {
+	case m.Field == nil || m.Peer == nil:
+		return ""
+	case m.IsAssignable:
+		return expr
+	case m.IsConvertible:
+		return m.Peer.TypeString() + "(" + expr + ")"
+	default:
+		return ""
+	}
+}
+
+// only the pairs
+func (s FieldMatches) Matched() FieldMatches {
+	var result FieldMatches
+	for _, match := range s {
+		if match.Field != nil && match.Peer != nil {
+			result = append(result, match)
+		}
+	}
+	return result
+}
+
+// MatchFields pairs the fields of a type with the fields of it's peer. A field is matched, in order : by the
+// mapping (field name to peer field name), by the tag with tagKey (e.g. `json`) having the same name on both
+// sides and finally by name. Unexported fields of a peer from another package are left out.
+// The result has the fields of the type (matched or not), followed by the peer fields which were not matched
+func MatchFields(typ, peer *TypeInfo, tagKey string, mapping map[string]string) FieldMatches {
+	var peerFields []*TypeInfo
+	for idx := range peer.Fields {
+		if peer.IsImported && !peer.Fields[idx].IsExported && !peer.Fields[idx].IsEmbedded {
+			continue
+		}
+		peerFields = append(peerFields, &peer.Fields[idx])
+	}
+	used := make(map[*TypeInfo]struct{})
+	find := func(matches func(*TypeInfo) bool) *TypeInfo {
+		for _, peerField := range peerFields {
+			if _, has := used[peerField]; !has && matches(peerField) {
+				used[peerField] = struct{}{}
+				return peerField
+			}
+		}
+		return nil
+	}
+	tagName := func(field *TypeInfo) string {
+		if tagKey == "" {
+			return ""
+		}
+		if tag := field.TagByKey(tagKey); tag != nil && tag.Name != "-" {
+			return tag.Name
+		}
+		return ""
+	}
+
+	var result FieldMatches
+	for idx := range typ.Fields {
+		match := FieldMatch{Field: &typ.Fields[idx]}
+		name := match.Field.FieldName()
+		if mapped, has := mapping[name]; has {
+			match.Peer = find(func(peerField *TypeInfo) bool { return peerField.FieldName() == mapped })
+			match.MatchedBy = MatchedByMapping
+		}
+		if tag := tagName(match.Field); match.Peer == nil && tag != "" {
+			match.Peer = find(func(peerField *TypeInfo) bool { return tagName(peerField) == tag })
+			match.MatchedBy = MatchedByTag
+		}
+		if match.Peer == nil {
+			match.Peer = find(func(peerField *TypeInfo) bool { return strings.EqualFold(peerField.FieldName(), name) })
+			match.MatchedBy = MatchedByName
+		}
+		if match.Peer == nil {
+			match.MatchedBy = ""
+		} else {
+			match.IsAssignable, match.IsConvertible = compatible(match.Field, match.Peer)
+		}
+		result = append(result, match)
+	}
+	for _, peerField := range peerFields {
+		if _, has := used[peerField]; !has {
+			result = append(result, FieldMatch{Peer: peerField})
+		}
+	}
+	return result
+}
+
+// tells if a value of from can be assigned or converted to to. The types may come from different loads of the
+// same package (which are not identical for the type checker), so the full type strings are compared too
+func compatible(from, to *TypeInfo) (bool, bool) {
+	if from.typ == nil || to.typ == nil {
+		return false, false
+	}
+	if types.AssignableTo(from.typ, to.typ) || types.TypeString(from.typ, nil) == types.TypeString(to.typ, nil) {
+		return true, true
+	}
+	return false, types.ConvertibleTo(from.typ, to.typ)
+}
+
+// parses a mapping like `FullName=Name,Birthday=Born`
+func parseMapping(mapping string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(mapping, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.Split(pair, "=")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("bad mapping %q : expecting `Field=PeerField`", pair)
+		}
+		result[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return result, nil
+}
+
+// loads the peer type given by -target (or the `target=` option of a directive). The target is a package folder
+// (relative to dir) or import path followed by the type name, e.g. `./../model_b/SomeProtoBufPayload`, or a qualified
+// type name e.g. `github.com/x/pb.Payload`, `pb.Payload` (see LookupType)
+func (c *Command) loadPeer(target, dir string) (*TypeInfo, error) {
+	if c.Result == nil {
+		return nil, fmt.Errorf("target %q : package was not analysed", target)
+	}
+	slash := strings.LastIndex(target, "/")
+	if slash < 0 || strings.LastIndex(target, ".") > slash {
+		return c.Result.TypeOf(target)
+	}
+	// the package is needed for knowing it's import path
+	loaded, err := packages.Load(&packages.Config{Mode: packages.NeedName, Dir: dir}, target[:slash])
+	if err != nil {
+		return nil, fmt.Errorf("target %q : %v", target, err)
+	}
+	if len(loaded) != 1 || len(loaded[0].Errors) > 0 {
+		return nil, fmt.Errorf("target %q : package %q could not be loaded", target, target[:slash])
+	}
+	return c.Result.TypeOf(loaded[0].PkgPath + "." + target[slash+1:])
+}
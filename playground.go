@@ -8,17 +8,16 @@ import (
 	_ "github.com/badu/stroo/statik"
 	"github.com/gorilla/mux"
 	"github.com/rakyll/statik/fs"
-	"go/format"
 	"go/parser"
 	"go/token"
 	"golang.org/x/tools/go/packages"
-	"golang.org/x/tools/imports"
 	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"text/template"
 )
 
@@ -277,7 +276,11 @@ type previewResponse struct {
 
 func strooHandler(command *Command) http.HandlerFunc {
 
-	var cachedResult *Code
+	var (
+		mu           sync.Mutex // guards the cached analysis, while it's replaced
+		cachedResult *PackageInfo
+		cachedConfig CodeConfig
+	)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		var request previewRequest
@@ -293,87 +296,95 @@ func strooHandler(command *Command) http.HandlerFunc {
 			return
 		}
 
+		mu.Lock()
 		// we're using cached result, so we don't stress the disk for nothing
 		if request.SourceChanged || cachedResult == nil {
-			// first we check the correctness of the source, so we don't write down for nothing
-			fileSet := token.NewFileSet()
-			_, err := parser.ParseFile(fileSet, packageName, request.Source, parser.DeclarationErrors|parser.AllErrors)
-			if err != nil {
-				respond(w, InvalidGoSource, err.Error())
-				return
-			}
-
-			// prepare a temp project
-			tempProj, err := CreateTempProj([]TemporaryPackage{{Name: packageName, Files: map[string]interface{}{"file.go": request.Source}}})
-			if err != nil {
-				respond(w, InvalidGoSource, err.Error())
-				return
-			}
-			// setup cleanup, so temporary files and folders gets deleted
-			defer tempProj.Cleanup()
-
-			tempProj.Config.Mode = packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports | packages.NeedDeps | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax | packages.NeedImports
-			// load package using the old way
-			thePackages, err := packages.Load(tempProj.Config, fmt.Sprintf("file=%s", tempProj.File(packageName, "file.go")))
-			if err != nil {
-				respond(w, InvalidPackage, err.Error())
-				return
-			}
-			if len(thePackages) != 1 {
-				respond(w, MalformedRequest{ErrorMessage: "expecting exactly one package", Type: OnePackage})
-				return
-			}
-
-			// create a temporary command to analyse the loaded package
-			codeBuilder := DefaultAnalyzer()
-			tempCommand := NewCommand(codeBuilder)
-			tempCommand.TestMode = command.TestMode
-			tempCommand.DebugPrint = command.DebugPrint
-			if err := tempCommand.Analyse(codeBuilder, thePackages[0]); err != nil {
-				respond(w, InvalidAnalysis, err.Error())
-				return
-			}
-			// convention : by default, the upper most type struct is provided to the code builder
-			firstTypeName := ""
-			if len(tempCommand.Result.Types) >= 1 {
-				firstTypeName = tempCommand.Result.Types[0].Kind
-				tempCommand.SelectedType = firstTypeName
-				tempCommand.CodeConfig.SelectedType = firstTypeName
-			}
-			// create code
-			cachedResult, err = New(tempCommand.Result, tempCommand.CodeConfig, tmpTemplate)
-			if err != nil {
-				respond(w, MalformedRequest{ErrorMessage: err.Error()})
+			result, config, ok := analyseSource(w, command, request.Source)
+			if !ok {
+				mu.Unlock()
 				return
 			}
+			cachedResult, cachedConfig = result, config
 		}
+		// templates only read the analysis, so requests are processed at the same time
+		result, config := cachedResult, cachedConfig
+		mu.Unlock()
 
-		cachedResult.ResetKeeper() // reset kept data (so we can refill it)
+		// create code, each request with it's own (the template gets bound to it)
+		code, err := New(result, config, tmpTemplate)
+		if err != nil {
+			respond(w, MalformedRequest{ErrorMessage: err.Error()})
+			return
+		}
 
 		// finally, we're processing the template over the result
 		var buf bytes.Buffer
-		if err := tmpTemplate.Execute(&buf, cachedResult); err != nil {
+		if err := code.Tmpl().Execute(&buf, code); err != nil {
 			respond(w, InvalidTemplate, err.Error())
 			return
 		}
 
-		optImports, err := imports.Process(packageName, buf.Bytes(), nil)
+		formatted, err := PostProcess(packageName, buf.Bytes(), code.Imports)
 		if err != nil {
 			respond(w, InvalidFormat, err.Error(), buf.String())
 			return
 		}
 
-		formatted, err := format.Source(optImports)
-		if err != nil {
-			respond(w, InvalidFormat, err.Error(), string(optImports))
-			return
-		}
-
 		response := previewResponse{Result: string(formatted)}
 		respond(w, response)
 	}
 }
 
+// analyses the source sent to the playground, responding with the error if it fails
+func analyseSource(w http.ResponseWriter, command *Command, source string) (*PackageInfo, CodeConfig, bool) {
+	// first we check the correctness of the source, so we don't write down for nothing
+	fileSet := token.NewFileSet()
+	_, err := parser.ParseFile(fileSet, packageName, source, parser.DeclarationErrors|parser.AllErrors)
+	if err != nil {
+		respond(w, InvalidGoSource, err.Error())
+		return nil, CodeConfig{}, false
+	}
+
+	// prepare a temp project
+	tempProj, err := CreateTempProj([]TemporaryPackage{{Name: packageName, Files: map[string]interface{}{"file.go": source}}})
+	if err != nil {
+		respond(w, InvalidGoSource, err.Error())
+		return nil, CodeConfig{}, false
+	}
+	// setup cleanup, so temporary files and folders gets deleted
+	defer tempProj.Cleanup()
+
+	tempProj.Config.Mode = packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports | packages.NeedDeps | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax | packages.NeedImports
+	// load package using the old way
+	thePackages, err := packages.Load(tempProj.Config, fmt.Sprintf("file=%s", tempProj.File(packageName, "file.go")))
+	if err != nil {
+		respond(w, InvalidPackage, err.Error())
+		return nil, CodeConfig{}, false
+	}
+	if len(thePackages) != 1 {
+		respond(w, MalformedRequest{ErrorMessage: "expecting exactly one package", Type: OnePackage})
+		return nil, CodeConfig{}, false
+	}
+
+	// create a temporary command to analyse the loaded package
+	codeBuilder := DefaultAnalyzer()
+	tempCommand := NewCommand(codeBuilder)
+	tempCommand.TestMode = command.TestMode
+	tempCommand.DebugPrint = command.DebugPrint
+	if err := tempCommand.Analyse(codeBuilder, thePackages[0]); err != nil {
+		respond(w, InvalidAnalysis, err.Error())
+		return nil, CodeConfig{}, false
+	}
+	// convention : by default, the upper most type struct is provided to the code builder
+	firstTypeName := ""
+	if len(tempCommand.Result.Types) >= 1 {
+		firstTypeName = tempCommand.Result.Types[0].Kind
+		tempCommand.SelectedType = firstTypeName
+		tempCommand.CodeConfig.SelectedType = firstTypeName
+	}
+	return tempCommand.Result, tempCommand.CodeConfig, true
+}
+
 func StartPlayground(command *Command) {
 	log.Printf("Starting on http://0.0.0.0:8080\n")
 	wd, err := os.Getwd()
@@ -0,0 +1,241 @@
+package stroo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"golang.org/x/tools/go/ast/astutil"
+	"strconv"
+	"strings"
+)
+
+const (
+	RegionBegin     = "// stroo:begin" // followed by the declared template name and the type e.g. `// stroo:begin String T`
+	RegionEnd       = "// stroo:end"
+	HeaderSignature = "by Stroo [https://github.com/badu/stroo]" // found in the header of every generated file
+)
+
+// returned (wrapped) when the output file exists, but it was not written by stroo
+var ErrNotGenerated = errors.New("file was not generated by stroo")
+
+// a piece of a go file : either a region (key is not empty) or the text between regions
+type segment struct {
+	key  string // e.g. "String T"
+	text string // including the region markers
+}
+
+// splits the source in regions and text between them
+func splitRegions(src []byte) ([]segment, error) {
+	var (
+		result  []segment
+		current strings.Builder
+		key     string
+		seen    = make(map[string]struct{})
+	)
+	for idx, line := range strings.SplitAfter(string(src), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, RegionBegin+" "):
+			if key != "" {
+				return nil, fmt.Errorf("line %d : region %q starts inside region %q", idx+1, trimmed, key)
+			}
+			key = strings.Join(strings.Fields(strings.TrimPrefix(trimmed, RegionBegin)), " ")
+			if _, has := seen[key]; has {
+				return nil, fmt.Errorf("line %d : region %q is duplicated", idx+1, key)
+			}
+			seen[key] = struct{}{}
+			if current.Len() > 0 {
+				result = append(result, segment{text: current.String()})
+				current.Reset()
+			}
+			current.WriteString(line)
+		case trimmed == RegionEnd:
+			if key == "" {
+				return nil, fmt.Errorf("line %d : region end without begin", idx+1)
+			}
+			current.WriteString(line)
+			result = append(result, segment{key: key, text: current.String()})
+			current.Reset()
+			key = ""
+		default:
+			current.WriteString(line)
+		}
+	}
+	if key != "" {
+		return nil, fmt.Errorf("region %q is not closed", key)
+	}
+	if current.Len() > 0 {
+		result = append(result, segment{text: current.String()})
+	}
+	return result, nil
+}
+
+// the leading comment lines of the file
+func leadingComment(src []byte) string {
+	var result strings.Builder
+	for _, line := range strings.SplitAfter(string(src), "\n") {
+		if !strings.HasPrefix(line, "//") || strings.HasPrefix(line, RegionBegin) {
+			break
+		}
+		result.WriteString(line)
+	}
+	return result.String()
+}
+
+// true if the file starts with the header written by stroo
+func HasStrooHeader(src []byte) bool {
+	return strings.Contains(leadingComment(src), HeaderSignature)
+}
+
+// MergeGenerated returns what should be written over an existing file, for the code generated by the template
+// declared as templateName (see `declare`).
+// If the existing file has regions, the regions of the template are replaced by the generated ones : the ones which
+// were not generated again (e.g. the type was removed or renamed) are dropped and the new ones are appended at the
+// end. The regions of other templates and the hand written code in between are kept. Otherwise, the generated code
+// replaces the whole file. Files without the stroo header are refused, unless forced
+func MergeGenerated(existing, generated []byte, templateName string, force bool) ([]byte, error) {
+	if !force && !HasStrooHeader(existing) {
+		return nil, ErrNotGenerated
+	}
+	existingSegments, err := splitRegions(existing)
+	if err != nil {
+		return nil, fmt.Errorf("existing file : %v", err)
+	}
+	hasRegions := false
+	for _, seg := range existingSegments {
+		if seg.key != "" {
+			hasRegions = true
+			break
+		}
+	}
+	if !hasRegions {
+		return generated, nil
+	}
+	generatedSegments, err := splitRegions(generated)
+	if err != nil {
+		return nil, fmt.Errorf("generated code : %v", err)
+	}
+	regions := make(map[string]string)
+	for _, seg := range generatedSegments {
+		if seg.key != "" {
+			regions[seg.key] = seg.text
+		}
+	}
+
+	var merged strings.Builder
+	for idx, seg := range existingSegments {
+		text := seg.text
+		if idx == 0 && seg.key == "" && HasStrooHeader(existing) {
+			// refresh the header
+			text = leadingComment(generated) + strings.TrimPrefix(text, leadingComment(existing))
+		}
+		if seg.key != "" {
+			if replacement, has := regions[seg.key]; has {
+				text = replacement
+				delete(regions, seg.key)
+			} else if isRegionOf(seg.key, templateName) {
+				continue // not generated anymore
+			}
+		}
+		merged.WriteString(text)
+	}
+	// regions that are new go at the end, in the order they were generated
+	for _, seg := range generatedSegments {
+		if text, has := regions[seg.key]; has {
+			merged.WriteString("\n" + text)
+		}
+	}
+	return mergeImports(generated, []byte(merged.String()))
+}
+
+// true if the region (e.g. "String T") was written by the template
+func isRegionOf(key, templateName string) bool {
+	return templateName != "" && (key == templateName || strings.HasPrefix(key, templateName+" "))
+}
+
+// when the generated code has regions, the code written by the template outside of them (e.g. helpers shared
+// by the types) goes into a region named as the template, placed after the imports, so it's replaced as well
+func wrapLoose(generated []byte, templateName string) ([]byte, error) {
+	segments, err := splitRegions(generated)
+	if err != nil || templateName == "" {
+		return generated, err
+	}
+	hasRegions := false
+	for _, seg := range segments {
+		if seg.key == templateName {
+			return generated, nil // already wrapped
+		}
+		hasRegions = hasRegions || seg.key != ""
+	}
+	if !hasRegions {
+		return generated, nil
+	}
+	// the header, the package clause and the imports stay where they are
+	file, err := parser.ParseFile(token.NewFileSet(), "", generated, parser.ImportsOnly)
+	if err != nil {
+		return nil, fmt.Errorf("generated code : %v", err)
+	}
+	preambleEnd := int(file.Name.End()) - 1
+	for _, decl := range file.Decls {
+		preambleEnd = int(decl.End()) - 1
+	}
+	var (
+		preamble, regions, loose strings.Builder
+		offset                   int
+	)
+	for _, seg := range segments {
+		text := seg.text
+		if seg.key == "" && offset < preambleEnd {
+			split := preambleEnd - offset
+			if split > len(text) {
+				split = len(text)
+			}
+			preamble.WriteString(text[:split])
+			text = text[split:]
+		}
+		offset += len(seg.text)
+		switch {
+		case seg.key != "":
+			regions.WriteString("\n" + text)
+		case strings.TrimSpace(text) != "":
+			loose.WriteString(strings.TrimSpace(text) + "\n\n")
+		}
+	}
+	if loose.Len() == 0 {
+		return generated, nil
+	}
+	result := preamble.String() + "\n\n" + RegionBegin + " " + templateName + "\n" + strings.TrimSpace(loose.String()) + "\n" + RegionEnd + "\n" + regions.String()
+	return format.Source([]byte(result))
+}
+
+// adds the imports of the generated code to the merged file
+func mergeImports(generated, merged []byte) ([]byte, error) {
+	fileSet := token.NewFileSet()
+	generatedFile, err := parser.ParseFile(fileSet, "", generated, parser.ImportsOnly)
+	if err != nil {
+		return nil, fmt.Errorf("generated code : %v", err)
+	}
+	mergedFile, err := parser.ParseFile(fileSet, "", merged, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("merged code : %v", err)
+	}
+	for _, imprt := range generatedFile.Imports {
+		importPath, err := strconv.Unquote(imprt.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		if imprt.Name != nil {
+			astutil.AddNamedImport(fileSet, mergedFile, imprt.Name.Name, importPath)
+		} else {
+			astutil.AddImport(fileSet, mergedFile, importPath)
+		}
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fileSet, mergedFile); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
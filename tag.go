@@ -22,74 +22,106 @@ var (
 	errTagNotExist    = errors.New("tag does not exist")
 )
 
+// TagError is returned by ParseTags when the tag is malformed.
+// Pos is the byte offset (inside the tag, without the surrounding backquotes) where the problem was found
+type TagError struct {
+	Tag string
+	Pos int
+	Err error
+}
+
+func (e *TagError) Error() string {
+	return fmt.Sprintf("%v at position %d in `%s`", e.Err, e.Pos, e.Tag)
+}
+
+func (e *TagError) Unwrap() error { return e.Err }
+
+// returns the tag text, without the surrounding quotes, as it was found in the source
+func rawTag(tag string) string {
+	if len(tag) >= 2 && tag[0] == '`' && tag[len(tag)-1] == '`' {
+		return tag[1 : len(tag)-1]
+	}
+	if unquoted, err := strconv.Unquote(tag); err == nil {
+		return unquoted
+	}
+	return tag
+}
+
+// parses all the `key:"value"` pairs of the tag (same rules as reflect.StructTag)
 func ParseTags(tag string) (Tags, error) {
 	if tag == "" {
 		return nil, nil
 	}
 
-	if tag[0] == '`' && tag[len(tag)-1] == '`' {
-		tag = tag[1 : len(tag)-1]
-	}
+	tag = rawTag(tag)
+	raw := tag
 
 	var tags Tags
-	i := 0
-	for i < len(tag) && tag[i] == ' ' {
-		i++
-	}
-	tag = tag[i:]
-	if tag == "" {
-		return nil, nil
-	}
+	for tag != "" {
+		// skip leading space
+		i := 0
+		for i < len(tag) && tag[i] == ' ' {
+			i++
+		}
+		tag = tag[i:]
+		if tag == "" {
+			break
+		}
+		pos := len(raw) - len(tag)
 
-	i = 0
-	for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
-		i++
-	}
+		// scan to colon. a space, a quote or a control character is a syntax error
+		i = 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
 
-	if i == 0 {
-		return nil, errTagKeySyntax
-	}
-	if i+1 >= len(tag) || tag[i] != ':' {
-		return nil, errTagSyntax
-	}
-	if tag[i+1] != '"' {
-		return nil, errTagValueSyntax
-	}
+		if i == 0 {
+			return nil, &TagError{Tag: raw, Pos: pos, Err: errTagKeySyntax}
+		}
+		if i+1 >= len(tag) || tag[i] != ':' {
+			return nil, &TagError{Tag: raw, Pos: pos + i, Err: errTagSyntax}
+		}
+		if tag[i+1] != '"' {
+			return nil, &TagError{Tag: raw, Pos: pos + i + 1, Err: errTagValueSyntax}
+		}
 
-	key := string(tag[:i])
-	tag = tag[i+1:]
+		key := tag[:i]
+		tag = tag[i+1:]
+		pos += i + 1
 
-	i = 1
-	for i < len(tag) && tag[i] != '"' {
-		if tag[i] == '\\' {
+		// scan quoted string to find value
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
 			i++
 		}
-		i++
-	}
-	if i >= len(tag) {
-		return nil, errTagValueSyntax
-	}
+		if i >= len(tag) {
+			return nil, &TagError{Tag: raw, Pos: pos, Err: errTagValueSyntax}
+		}
 
-	qValue := string(tag[:i+1])
-	tag = tag[i+1:]
+		qValue := tag[:i+1]
+		tag = tag[i+1:]
 
-	value, err := strconv.Unquote(qValue)
-	if err != nil {
-		return nil, errTagValueSyntax
-	}
+		value, err := strconv.Unquote(qValue)
+		if err != nil {
+			return nil, &TagError{Tag: raw, Pos: pos, Err: errTagValueSyntax}
+		}
 
-	res := strings.Split(value, ",")
-	name := res[0]
-	options := res[1:]
-	if len(options) == 0 {
-		options = nil
-	}
+		res := strings.Split(value, ",")
+		name := res[0]
+		options := res[1:]
+		if len(options) == 0 {
+			options = nil
+		}
 
-	tags = append(tags, &Tag{
-		Key:     key,
-		Name:    name,
-		Options: options,
-	})
+		tags = append(tags, &Tag{
+			Key:     key,
+			Name:    name,
+			Options: options,
+		})
+	}
 
 	return tags, nil
 }
@@ -111,3 +143,12 @@ func (t Tags) Get(key string) (*Tag, error) {
 
 	return nil, errTagNotExist
 }
+
+// returns the keys of the tags, in the order they were declared
+func (t Tags) Keys() []string {
+	var result []string
+	for _, tag := range t {
+		result = append(result, tag.Key)
+	}
+	return result
+}
@@ -0,0 +1,55 @@
+package stroo_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/badu/stroo"
+	"github.com/badu/stroo/halp"
+)
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags("`json:\"id,omitempty\" db:\"user_id\" validate:\"required,min=1\"`")
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	expected := Tags{
+		&Tag{Key: "json", Name: "id", Options: []string{"omitempty"}},
+		&Tag{Key: "db", Name: "user_id"},
+		&Tag{Key: "validate", Name: "required", Options: []string{"min=1"}},
+	}
+	if compared := halp.Equal(tags, expected); compared != nil {
+		t.Fatalf("expected :\n%s\nactual :\n%s\n", halp.SPrint(expected), halp.SPrint(tags))
+	}
+	db, err := tags.Get("db")
+	if err != nil {
+		t.Fatalf("error : %v", err)
+	}
+	if db.Name != "user_id" {
+		t.Fatalf("expected `user_id`, got %q", db.Name)
+	}
+}
+
+func TestParseTagsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		tag string
+		pos int
+	}{
+		{tag: "`json:\"id\" db`", pos: 12},
+		{tag: "`json:\"id\" db:user_id`", pos: 13},
+		{tag: "`json:\"id\" db:\"user_id`", pos: 13},
+		{tag: "`json:\"id\"  :\"x\"`", pos: 11},
+	} {
+		_, err := ParseTags(tc.tag)
+		if err == nil {
+			t.Fatalf("expected error parsing %s", tc.tag)
+		}
+		var tagErr *TagError
+		if !errors.As(err, &tagErr) {
+			t.Fatalf("expected *TagError, got %T", err)
+		}
+		if tagErr.Pos != tc.pos {
+			t.Errorf("%s : expected error at %d, got %d (%v)", tc.tag, tc.pos, tagErr.Pos, err)
+		}
+	}
+}
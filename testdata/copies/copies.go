@@ -0,0 +1,18 @@
+package copies
+
+// Left and Right are generated in their own files, Shared is copied by both
+//
+//stroo:gen template=builtin:deep-copy output=left_gen.go
+type Left struct {
+	Shared *Shared
+}
+
+//stroo:gen template=builtin:deep-copy output=right_gen.go
+type Right struct {
+	Shared *Shared
+	Left   Left
+}
+
+type Shared struct {
+	Values []int
+}
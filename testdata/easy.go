@@ -163,3 +163,264 @@ type NormalStruct struct {
 type Service interface {
 	Store(*TestData) (*TestData, error)
 }
+
+type T19 struct {
+	Users  map[string]*S4
+	Events chan<- S3
+	Ticks  <-chan time.Time
+	Index  map[S]map[string]int
+}
+
+type Set map[string]struct{}
+
+type List[T any] []T
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+type Page[T any] struct {
+	Items []T
+	Total int
+}
+
+func (p Page[T]) Len() int { return len(p.Items) }
+
+type T20 struct {
+	Ints  List[int]
+	Pairs []Pair[string, *S4]
+	Paged *Page[S3]
+}
+
+type IntList List[int]
+
+var DefaultPage = Page[int]{}
+
+func Map[K comparable, V any](m map[K]V) []V {
+	result := make([]V, 0, len(m))
+	for _, v := range m {
+		result = append(result, v)
+	}
+	return result
+}
+
+// a field named like a type shouldn't confuse the kind of other fields
+type Shadow struct {
+	S13 int
+}
+
+type T21 struct {
+	Ref   S13
+	Bytes [16]byte
+}
+
+//stroo:json
+type Marked struct {
+	Name string
+}
+
+// Tagged is also selected by the marker
+//
+//stroo:json
+type Tagged struct {
+	Value int
+}
+
+// Directed asks for its own stringer
+//
+//stroo:gen template=../templates/stringer.tmpl output=directed_gen.go
+type Directed struct {
+	Name  string
+	Count int
+}
+
+//stroo:gen template=../templates/stringer.tmpl output=directed_gen.go
+type AlsoDirected struct {
+	Flag bool
+}
+
+// covers the field kinds of the builtin templates
+type Everything struct {
+	ID      int               `json:"id"`
+	Name    string            `json:"name,omitempty"`
+	Secret  string            `json:"-"`
+	Dash    string            `json:"-,"`
+	Ptr     *S3               `json:"ptr,omitempty"`
+	Items   []S13             `json:"items,omitempty"`
+	Refs    []*S4             `json:"refs"`
+	Index   map[string]*S4    `json:"index,omitempty"`
+	Counts  map[S3]int        `json:"-"`
+	Fixed   [4]byte           `json:"fixed,omitempty"`
+	Nested  *[]int            `json:"nested,omitempty"`
+	When    time.Time         `json:"when"`
+	Flag    bool              `json:"flag,omitempty"`
+	Ratio   float64           `json:"ratio,omitempty"`
+	Any     interface{}       `json:"any,omitempty"`
+	Events  chan<- S3         `json:"-"`
+	Handler func(int) error   `json:"-"`
+	Meta    struct{ A int }   `json:"meta"`
+	Pairs   []Pair[string, S] `json:"pairs,omitempty"`
+	private bool
+	S3
+}
+
+// Weekday is an enum
+type Weekday int
+
+const (
+	// Sunday starts the week
+	Sunday Weekday = iota
+	Monday
+	Tuesday
+	_
+	Friday  // comes after the skipped ones
+	Weekend = Sunday
+)
+
+// Level is an enum of strings
+type Level string
+
+const Debug Level = "debug"
+
+const (
+	Info  Level = "info"
+	Error Level = "error"
+	local       = 1
+)
+
+// Named has methods on both receivers
+type Named struct {
+	Name string
+}
+
+func (n Named) String() string { return n.Name }
+
+func (n *Named) SetName(name string) { n.Name = name }
+
+// Namer is implemented by a pointer to Named
+type Namer interface {
+	SetName(name string)
+}
+
+// Promoted gets the methods of Named
+type Promoted struct {
+	Named
+	When time.Time
+}
+
+// PersonDTO is converted to and from people.Person (see -target)
+type PersonDTO struct {
+	FullName string `json:"name"`
+	Birthday time.Time
+	Street   string
+	Height   int64
+}
+
+// Located is documented, for checking positions
+type Located struct {
+	// ID identifies it
+	ID int // never zero
+}
+
+// Locate has a doc too
+func Locate() Located { return Located{} }
+
+// Origin is where it starts
+var Origin = Located{} // the zero value
+
+// Join has every kind of param
+func Join(sep string, first, second int, rest ...*Located) (joined string, err error) { return "", nil }
+
+// Merge has params of local and unnamed kinds
+func (l Located) Merge(other Located, extra map[string][]int) Located { return l }
+
+// Visit has unnamed params
+type Visit func(int, ...string) bool
+
+// Registry embeds Namer, which comes after the declared methods
+type Registry[T any] interface {
+	// Register adds the items
+	Register(key string, items ...T) (int, error)
+	Namer
+	Lookup(string) (T, bool)
+}
+
+// Number is a constraint, it can't be mocked
+type Number interface {
+	~int | ~int64 | float64
+}
+
+// Integer keeps the integers of Number
+type Integer interface {
+	Number
+	int | int64
+	comparable
+}
+
+// Nested has slices and arrays inside each other
+type Nested struct {
+	Grid [4][]int
+	Rows [][4]int
+	Ptrs []*[2]map[string][]byte
+}
+
+// Config has anonymous sections, like yaml configs do
+type Config struct {
+	Server struct {
+		// Host is where to listen
+		Host string `yaml:"host"`
+		TLS  *struct {
+			Cert string `yaml:"cert"` // the certificate file
+		} `yaml:"tls"`
+	} `yaml:"server"`
+	Backends []struct {
+		URL string `yaml:"url"`
+	} `yaml:"backends"`
+}
+
+// Text is another name for string
+type Text = string
+
+// Prices2 is another name for a slice of Price2
+type Prices2 = []Price2
+
+// Entry is another name for S3
+type Entry = S3
+
+// PtrSlices points to slices and arrays
+type PtrSlices struct {
+	Ints  *[]int
+	Fixed *[4]int
+	Ptrs  []*int
+}
+
+// Contact writes it's Mail with the key of the embedded EmbeddedS.Email
+type Contact struct {
+	EmbeddedS
+	Mail string `json:"mail"`
+}
+
+// BadTag has a tag which doesn't follow the `key:"value"` convention
+type BadTag struct {
+	Name string `json:"name" db`
+}
+
+// the doc of the group belongs to none of it's types
+type (
+	// GroupedA has it's own doc
+	GroupedA int
+	GroupedB int
+)
+
+// Inner is the struct of DefInner and AliasInner
+type Inner struct {
+	Values []int
+	Index  map[string]int
+}
+
+// DefInner is a defined type over a struct of the package
+type DefInner Inner
+
+// AliasInner is an alias of a struct of the package
+type AliasInner = Inner
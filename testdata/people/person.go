@@ -0,0 +1,17 @@
+package people
+
+import "time"
+
+// Address is nested in Person
+type Address struct {
+	Street string `json:"street"`
+}
+
+// Person is described from another package
+type Person struct {
+	Name   string `json:"name"`
+	Home   Address
+	Born   time.Time
+	Height int32
+	age    int
+}
@@ -5,31 +5,61 @@ import (
 	"go/ast"
 	"go/types"
 	"log"
+	"strings"
 )
 
 type TypeInfo struct {
-	Package     string            // current or imported package name
-	PackagePath string            // current or imported package path
-	Name        string            // for `type` in case of struct or func type declaration Name == Kind; for `field` the name of the field
-	Kind        string            // for `type` usually the way we Extract; for `field` the kind of the field (for extracting `type`)
-	Tags        Tags              // tags, for both
-	Prefix      string            // `field` info property, for storing embedding names
-	Fields      TypesSlice        // for `type` fields ; for `field` is always nil
-	MethodList  Methods           // for `type` methods ; for `field` first element contains `func data` if it's marked as `IsFunc`
-	IsArray     bool              // for `type` if it's array it's not a struct, it's struct; for `field` if it's an array
-	IsPointer   bool              // for `type` if array, it's pointer; for `field` if it's a pointer
-	IsImported  bool              // for `type` if kind it's an imported one; for `field` if it's external to current package
-	IsAlias     bool              // for `type` if it's alias; for `field` it's always false
-	IsFunc      bool              // for `type` if it's a function type definition; for `field`
-	IsStruct    bool              // `field` info property
-	IsMap       bool              // `field` info property
-	IsChan      bool              // `field` info property
-	IsExported  bool              // `field` info property
-	IsEmbedded  bool              // `field` info property
-	IsInterface bool              // `field` info property
-	Comment     *ast.CommentGroup // comment found in AST
+	Package          string            // current or imported package name
+	PackagePath      string            // current or imported package path
+	Name             string            // for `type` in case of struct or func type declaration Name == Kind; for `field` the name of the field
+	Kind             string            // for `type` usually the way we Extract; for `field` the kind of the field (for extracting `type`)
+	Tags             Tags              // tags, for both
+	RawTag           string            // `field` info property, the tag text as found in source (without backquotes)
+	Prefix           string            // `field` info property, for storing embedding names
+	Fields           TypesSlice        // for `type` fields ; for `field` the fields of an inline struct (e.g. `Meta struct{ A int }`), nil otherwise
+	MethodList       Methods           // for `type` methods ; for `field` first element contains `func data` if it's marked as `IsFunc`
+	ValueMethods     Methods           // for `type` the method set of the type, including the methods promoted from embedded fields
+	PointerMethods   Methods           // for `type` the method set of a pointer to the type (empty for interfaces)
+	IsArray          bool              // for `type` if it's array it's not a struct, it's struct; for `field` if it's an array (or a slice)
+	IsSlice          bool              // if it's a slice, e.g. `[]byte`; IsArray without IsSlice is a fixed size array of Len items
+	IsPointer        bool              // if it's a pointer, also to a slice or array (`*[]int`) or for slices of pointers (`[]*int`, see Item)
+	IsImported       bool              // for `type` if kind it's an imported one; for `field` if it's external to current package
+	IsAlias          bool              // for `type` if it's an alias (`type A = B`), not a defined type (`type A B`); for `field` it's always false
+	IsFunc           bool              // for `type` if it's a function type definition; for `field`
+	IsStruct         bool              // `field` info property
+	IsMap            bool              // `field` info property
+	IsChan           bool              // `field` info property
+	IsExported       bool              // `field` info property
+	IsEmbedded       bool              // `field` info property
+	IsInterface      bool              // `field` info property
+	Key              *TypeInfo         // for maps, the key type
+	Elem             *TypeInfo         // for maps, the value type; for chans, the element type
+	ChanDir          string            // for chans, the direction : "chan", "chan<-" or "<-chan"
+	Len              int64             // for arrays, the length (e.g. 16 for `[16]byte`)
+	Item             *TypeInfo         // for slices and arrays, the items as they are (e.g. `[]int` for `[][]int`); Kind is the innermost
+	Underlying       *TypeInfo         // for `type` the underlying type (e.g. `string` for `type Name string`); nil for structs and interfaces
+	TypeParams       TypeParams        // for `type` the type parameters of a generic declaration (e.g. `type Page[T any] struct{}`)
+	TypeArgs         TypesSlice        // for `field` the type arguments of an instantiated generic type (e.g. `List[int]`)
+	IsTypeParam      bool              // for `field` if the kind is a type parameter of the enclosing declaration
+	Consts           Consts            // for `type` the constants declared with this type (enums), in order of declaration
+	InterfaceMethods Methods           // for interfaces, all the methods : the declared ones, then the ones of the embedded interfaces
+	TypeSet          TypeTerms         // for constraint interfaces, the types allowed (e.g. `~int | ~string`); empty if any type is
+	IsComparable     bool              // for constraint interfaces, if all the types allowed are comparable (e.g. `comparable` is embedded)
+	Comment          *ast.CommentGroup // comment found in AST
+	Doc              string            // the documentation written above the declaration, as text
+	LineComment      string            // the comment written after the declaration, on the same line, as text
+	File             string            // the file where the type or field is declared (empty for the kinds of fields)
+	Line             int               // the line of the declaration, e.g. for writing `//line` directives
+	Column           int               // the column of the declaration
+	typeString       string            // the type as written in code (see TypeString)
+	typ              types.Type        // the type checker's type (see Implements)
 }
 
+// the type as it would be written in code, qualified with the package name if it's imported
+// e.g. `[]*time.Time`, `map[string]Page[int]` or `Page[T]` for a generic declaration
+func (t *TypeInfo) TypeString() string { return t.typeString }
+
+// describes a declared type by the type on the right hand side of the declaration, e.g. `type Timer time.Ticker`
 func NewAliasFromField(pkg *types.Package, field *TypeInfo, name string) TypeInfo {
 	return TypeInfo{
 		Package:     pkg.Name(),
@@ -37,37 +67,119 @@ func NewAliasFromField(pkg *types.Package, field *TypeInfo, name string) TypeInf
 		Name:        name,
 		Kind:        field.Kind,
 		IsArray:     field.IsArray,
+		IsSlice:     field.IsSlice,
+		Len:         field.Len,
+		Item:        field.Item,
 		IsPointer:   field.IsPointer,
 		IsImported:  field.IsImported,
-		IsAlias:     true,
+		IsMap:       field.IsMap,
+		IsChan:      field.IsChan,
+		ChanDir:     field.ChanDir,
+		Key:         field.Key,
+		Elem:        field.Elem,
+		TypeArgs:    field.TypeArgs,
 	}
 }
 
+// true if one of the comment lines (including directives like `//stroo:json`) contains the marker
+func (t *TypeInfo) HasMarker(marker string) bool {
+	if t.Comment == nil {
+		return false
+	}
+	for _, comment := range t.Comment.List {
+		if strings.Contains(comment.Text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// the name used for selecting the field : embedded fields have no Name, they are selected by their type name
+// e.g. `st.Ticker` for an embedded `*time.Ticker`
+func (t *TypeInfo) FieldName() string {
+	if t.Name != "" || !t.IsEmbedded {
+		return t.Name
+	}
+	kind := t.Kind
+	if idx := strings.LastIndex(kind, "."); idx >= 0 {
+		kind = kind[idx+1:]
+	}
+	if idx := strings.Index(kind, "["); idx >= 0 {
+		kind = kind[:idx]
+	}
+	return kind
+}
+
+// true if there are constants declared with this type, e.g. `const ( Red Color = iota ; Green )`
+func (t *TypeInfo) IsEnum() bool {
+	return len(t.Consts) > 0
+}
+
+// true if the type, or a pointer to it, implements the interface
+func (t *TypeInfo) Implements(iface *types.Interface) bool {
+	if t.typ == nil {
+		return false
+	}
+	if types.Implements(t.typ, iface) {
+		return true
+	}
+	if _, isPointer := t.typ.Underlying().(*types.Pointer); isPointer || types.IsInterface(t.typ) {
+		return false
+	}
+	return types.Implements(types.NewPointer(t.typ), iface)
+}
+
 func (t *TypeInfo) IsBasic() bool {
 	return IsBasic(t.Kind)
 }
 
 func (t *TypeInfo) Clone(newName string) TypeInfo {
 	result := TypeInfo{
-		Name:        newName,
-		Kind:        t.Kind,
-		IsPointer:   t.IsPointer,
-		IsStruct:    t.IsStruct,
-		IsArray:     t.IsArray,
-		IsMap:       t.IsMap,
-		IsChan:      t.IsChan,
-		IsExported:  t.IsExported,
-		IsEmbedded:  t.IsEmbedded,
-		IsImported:  t.IsImported,
-		IsInterface: t.IsInterface,
-		IsFunc:      t.IsFunc,
-		Tags:        t.Tags,
-		Package:     t.Package,
-		PackagePath: t.PackagePath,
-		Comment:     t.Comment,
-		Prefix:      t.Prefix,
-	}
-	copy(result.MethodList, t.MethodList)
+		Name:             newName,
+		Kind:             t.Kind,
+		IsPointer:        t.IsPointer,
+		IsAlias:          t.IsAlias,
+		IsStruct:         t.IsStruct,
+		IsArray:          t.IsArray,
+		IsSlice:          t.IsSlice,
+		Len:              t.Len,
+		Item:             t.Item,
+		Underlying:       t.Underlying,
+		IsMap:            t.IsMap,
+		IsChan:           t.IsChan,
+		IsExported:       t.IsExported,
+		IsEmbedded:       t.IsEmbedded,
+		IsImported:       t.IsImported,
+		IsInterface:      t.IsInterface,
+		IsFunc:           t.IsFunc,
+		Key:              t.Key,
+		Elem:             t.Elem,
+		ChanDir:          t.ChanDir,
+		Fields:           append(TypesSlice(nil), t.Fields...),
+		MethodList:       append(Methods(nil), t.MethodList...),
+		TypeParams:       t.TypeParams,
+		TypeArgs:         t.TypeArgs,
+		IsTypeParam:      t.IsTypeParam,
+		Consts:           t.Consts,
+		InterfaceMethods: t.InterfaceMethods,
+		TypeSet:          t.TypeSet,
+		IsComparable:     t.IsComparable,
+		ValueMethods:     t.ValueMethods,
+		PointerMethods:   t.PointerMethods,
+		Tags:             t.Tags,
+		RawTag:           t.RawTag,
+		Package:          t.Package,
+		PackagePath:      t.PackagePath,
+		Comment:          t.Comment,
+		Doc:              t.Doc,
+		LineComment:      t.LineComment,
+		File:             t.File,
+		Line:             t.Line,
+		Column:           t.Column,
+		Prefix:           t.Prefix,
+		typeString:       t.typeString,
+		typ:              t.typ,
+	}
 	return result
 }
 
@@ -101,12 +213,25 @@ func (t *TypeInfo) PackageAndKind() string {
 	return t.Package + "." + t.Kind
 }
 
-// in case we need to print `*Something` instead of `Something`
+// in case we need to print `*Something` instead of `Something` (or `List[int]` instead of `List`)
 func (t *TypeInfo) RealKind() string {
+	kind := t.Kind
+	if len(t.TypeArgs) > 0 {
+		args := make([]string, 0, len(t.TypeArgs))
+		for _, arg := range t.TypeArgs {
+			args = append(args, arg.RealKind())
+		}
+		kind += "[" + strings.Join(args, ", ") + "]"
+	}
 	if t.IsPointer {
-		return "*" + t.Kind
+		return "*" + kind
 	}
-	return t.Kind
+	return kind
+}
+
+// true if the declaration has type parameters
+func (t *TypeInfo) IsGeneric() bool {
+	return len(t.TypeParams) > 0
 }
 
 func (t *TypeInfo) TagsByKey(name string) []string {
@@ -121,6 +246,18 @@ func (t *TypeInfo) TagsByKey(name string) []string {
 	return tag.Options
 }
 
+// returns the tag with the provided key or nil if it doesn't exist
+func (t *TypeInfo) TagByKey(name string) *Tag {
+	if t.Tags == nil {
+		return nil
+	}
+	tag, err := t.Tags.Get(name)
+	if err != nil {
+		return nil
+	}
+	return tag
+}
+
 func (t *TypeInfo) IsBool() bool {
 	return t.Kind == "bool"
 }
@@ -177,13 +314,15 @@ func (s TypesSlice) HasFieldKind(kind string) bool {
 
 // this should be called only from Code's StructByKey method
 func (s TypesSlice) Extract(typeName string) *TypeInfo {
+	// first try by "Name" (e.g. `type Items []*Item` has the name `Items` and the kind `Item`)
 	for _, typeDef := range s {
-		// first try by "Kind"
-		if typeDef.Kind == typeName {
+		if typeDef.Name == typeName {
 			return &typeDef
 		}
-		// next try by "Name"
-		if typeDef.Name == typeName {
+	}
+	// next try by "Kind"
+	for _, typeDef := range s {
+		if typeDef.Kind == typeName {
 			return &typeDef
 		}
 	}
@@ -191,9 +330,17 @@ func (s TypesSlice) Extract(typeName string) *TypeInfo {
 }
 
 type VarInfo struct {
-	Name string
-	Type *TypeInfo
-	Kind string
+	Name        string    // empty for unnamed params and returns
+	Type        *TypeInfo // the declaration of the kind, if it's a type of the current package
+	Kind        string    // for params and returns, the kind as for fields (e.g. `Item` for `[]*Item`)
+	TypeString  string    // for params and returns, the type as written in the signature e.g. `[]*Item` or `...Option`
+	IsVariadic  bool      // for params, the last one of a variadic function (TypeString is `...T`, Info describes `[]T`)
+	Info        *TypeInfo // for params and returns, the description of the type (flags, key, element, etc.)
+	Doc         string    // the documentation of the `var` or `const`, as text
+	LineComment string    // the comment after the declaration, as text
+	File        string    // where the `var` or `const` is declared
+	Line        int
+	Column      int
 }
 
 type Vars []VarInfo
@@ -209,6 +356,33 @@ func (s Vars) Less(i, j int) bool {
 }
 func (s Vars) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
+type ConstInfo struct {
+	Name        string            // e.g. `Red`
+	Value       string            // the evaluated value, as a literal e.g. `2` or `"red"`
+	Iota        int               // the index of the spec in it's `const` block, which is the value of iota
+	IsExported  bool              // if the name starts with an upper case letter
+	IsDuplicate bool              // has the same value as a previous constant of the type (e.g. `Default = Red`)
+	Comment     *ast.CommentGroup // doc comment found in AST (the line comment, if there is no doc)
+	Doc         string            // the documentation written above the constant (or it's block, if it's alone in it), as text
+	LineComment string            // the comment written after the constant, on the same line, as text
+	File        string            // the file where the constant is declared
+	Line        int               // the line of the declaration
+	Column      int               // the column of the declaration
+}
+
+type Consts []ConstInfo
+
+// the constants which have values not seen before, e.g. for generating a switch on values
+func (s Consts) Unique() Consts {
+	var result Consts
+	for _, constant := range s {
+		if !constant.IsDuplicate {
+			result = append(result, constant)
+		}
+	}
+	return result
+}
+
 type FunctionInfo struct {
 	Package          string
 	PackagePath      string
@@ -218,11 +392,62 @@ type FunctionInfo struct {
 	ReceiverType     string
 	IsMethodReceiver bool
 	IsExported       bool
+	IsPromoted       bool       // in method sets, if the method comes from an embedded field
+	TypeParams       TypeParams // for generic functions e.g. `func Map[K comparable, V any]()`
 	Params           []VarInfo
 	Returns          []VarInfo
+	Doc              string // the documentation of the function, as text
+	File             string // where the function is declared (functions have no line comments)
+	Line             int
+	Column           int
 	comment          *ast.CommentGroup
 }
 
+// the params as declared, e.g. `ctx context.Context, p1 string, opts ...Option`.
+// Unnamed (or blank) params are named by their position, so they can be used in a call (see Arguments)
+func (f FunctionInfo) ParamsDeclaration() string {
+	parts := make([]string, 0, len(f.Params))
+	for idx, param := range f.Params {
+		parts = append(parts, paramName(idx, param)+" "+param.TypeString)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// the params as arguments of a call, e.g. `ctx, p1, opts...`
+func (f FunctionInfo) Arguments() string {
+	parts := make([]string, 0, len(f.Params))
+	for idx, param := range f.Params {
+		name := paramName(idx, param)
+		if param.IsVariadic {
+			name += "..."
+		}
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// the returns as declared, without names, e.g. `error` or `(int, error)` (empty if there are none)
+func (f FunctionInfo) ReturnsDeclaration() string {
+	parts := make([]string, 0, len(f.Returns))
+	for _, result := range f.Returns {
+		parts = append(parts, result.TypeString)
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+func paramName(idx int, param VarInfo) string {
+	if param.Name == "" || param.Name == "_" {
+		return fmt.Sprintf("p%d", idx)
+	}
+	return param.Name
+}
+
 type Methods []FunctionInfo
 
 // implementation of Sorter interface, so we can sort
@@ -235,3 +460,59 @@ func (s Methods) Less(i, j int) bool {
 	return s[i].Kind < s[j].Kind
 }
 func (s Methods) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+type TypeParam struct {
+	Name       string // e.g. `K` in `[K comparable]`
+	Constraint string // e.g. `comparable` in `[K comparable]`, as it was declared
+}
+
+type TypeParams []TypeParam
+
+// returns the declaration of type parameters, e.g. `[K comparable, V any]` (empty if not generic)
+func (p TypeParams) Declaration() string {
+	if len(p) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(p))
+	for _, param := range p {
+		parts = append(parts, param.Name+" "+param.Constraint)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// returns the usage of type parameters, e.g. `[K, V]` (empty if not generic)
+func (p TypeParams) Names() string {
+	if len(p) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(p))
+	for _, param := range p {
+		parts = append(parts, param.Name)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// a type allowed by a constraint, e.g. `~int` in `interface{ ~int | ~string }`
+type TypeTerm struct {
+	Tilde bool      // types having it as underlying type are allowed too, e.g. `~int`
+	Type  *TypeInfo // the type, e.g. `int`
+}
+
+// the term as written in code, e.g. `~int`
+func (t TypeTerm) String() string {
+	if t.Tilde {
+		return "~" + t.Type.TypeString()
+	}
+	return t.Type.TypeString()
+}
+
+type TypeTerms []TypeTerm
+
+// the union as written in code, e.g. `~int | ~string`
+func (s TypeTerms) String() string {
+	parts := make([]string, 0, len(s))
+	for _, term := range s {
+		parts = append(parts, term.String())
+	}
+	return strings.Join(parts, " | ")
+}
@@ -0,0 +1,153 @@
+package stroo
+
+import (
+	"context"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/packages"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	watchInterval = 200 * time.Millisecond // how often the watched files are checked
+	watchDebounce = 300 * time.Millisecond // changes are applied after the files are left alone this long
+)
+
+// what the watcher knows about a file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// the watched files : go files of the packages and templates
+type watchedFiles struct {
+	goFiles   map[string]fileStamp
+	templates map[string]fileStamp
+}
+
+// WatchAll generates, then generates again every time the go files of the packages or the templates change, until the
+// context is done. Changed go files reload the packages, while changed templates only generate again (the packages
+// are kept in memory). Files are polled and changes are debounced, so saving many files triggers one generation.
+// The files written by stroo are not watched, so generating doesn't trigger itself. Errors don't stop the watch :
+// they are given to onRun, called after each generation with the reports of the packages
+func (c *Command) WatchAll(ctx context.Context, analyzer *analysis.Analyzer, patterns []string, onRun func([]PackageReport, error)) error {
+	var (
+		loaded []*packages.Package
+		dirs   []string // folders of the packages, kept when loading fails so they are still watched
+	)
+	load := func() error {
+		result, err := loadPackages(ctx, c.WorkingDir, patterns...)
+		if err != nil {
+			return err
+		}
+		loaded, dirs = result, nil
+		for _, loadedPackage := range loaded {
+			if len(loadedPackage.GoFiles) > 0 {
+				dirs = append(dirs, filepath.Dir(loadedPackage.GoFiles[0]))
+			}
+		}
+		return nil
+	}
+	generate := func() {
+		c.Out.Reset()
+		c.Outputs, c.Stale, c.Templates = nil, nil, nil
+		onRun(c.GenerateAll(analyzer, loaded), nil)
+	}
+
+	if err := load(); err != nil {
+		return err
+	}
+	generate()
+	current := c.watched(dirs)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	var (
+		changedAt      time.Time // zero if nothing is pending
+		goFilesChanged bool      // the packages have to be loaded again
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			next := c.watched(dirs)
+			goChanged := !sameStamps(current.goFiles, next.goFiles)
+			if goChanged || !sameStamps(current.templates, next.templates) {
+				current = next
+				changedAt = now
+				goFilesChanged = goFilesChanged || goChanged
+				continue
+			}
+			if changedAt.IsZero() || now.Sub(changedAt) < watchDebounce {
+				continue
+			}
+			changedAt = time.Time{}
+			if goFilesChanged {
+				goFilesChanged = false
+				if err := load(); err != nil {
+					onRun(nil, err)
+					continue
+				}
+			}
+			generate()
+			// outputs are not watched and templates can be others (e.g. a new directive)
+			current = c.watched(dirs)
+		}
+	}
+}
+
+// stamps the go files found in the package folders (the generated ones are left out) and the templates
+func (c *Command) watched(dirs []string) watchedFiles {
+	outputs := make(map[string]struct{})
+	for _, output := range c.Outputs {
+		outputs[output] = struct{}{}
+	}
+	result := watchedFiles{goFiles: make(map[string]fileStamp), templates: make(map[string]fileStamp)}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := filepath.Join(dir, entry.Name())
+			if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			if _, has := outputs[name]; has {
+				continue
+			}
+			if stamp, ok := stampOf(name); ok {
+				result.goFiles[name] = stamp
+			}
+		}
+	}
+	for _, templateFile := range c.Templates {
+		if stamp, ok := stampOf(templateFile); ok {
+			result.templates[templateFile] = stamp
+		}
+	}
+	return result
+}
+
+func stampOf(fileName string) (fileStamp, bool) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return fileStamp{}, false
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, true
+}
+
+// true if the same files have the same stamps
+func sameStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, stamp := range a {
+		if other, has := b[name]; !has || other.size != stamp.size || !other.modTime.Equal(stamp.modTime) {
+			return false
+		}
+	}
+	return true
+}